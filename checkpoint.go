@@ -0,0 +1,251 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrVersionMismatch is returned when restoring a checkpoint written by a
+// different machine version that no migration can upgrade.
+var ErrVersionMismatch = errors.New("Checkpoint version mismatch")
+
+// GuardCheckpointer is implemented by guards carrying state, such as retry
+// counters, that has to survive a Checkpoint and RestoreCheckpoint cycle.
+type GuardCheckpointer interface {
+	Guard
+	// CheckpointGuard returns the guard state.
+	CheckpointGuard() ([]byte, error)
+	// RestoreGuard loads state returned by CheckpointGuard.
+	RestoreGuard(data []byte) error
+}
+
+// checkpoint is the serialized form of the machine runtime state.
+type checkpoint struct {
+	Version int               `json:"version,omitempty"`
+	State   string            `json:"state"`
+	Guards  []guardCheckpoint `json:"guards,omitempty"`
+}
+
+// migration upgrades a checkpoint from one version to another.
+type migration struct {
+	to int
+	fn func([]byte) ([]byte, error)
+}
+
+// runtimeState is the serialized form of the current and previous state.
+type runtimeState struct {
+	State    string `json:"state"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// guardCheckpoint holds the state of a single guard.
+type guardCheckpoint struct {
+	State string `json:"state"`
+	Index int    `json:"index"`
+	Data  []byte `json:"data"`
+}
+
+// Checkpoint serializes the current state name along with the state of every
+// guard implementing GuardCheckpointer.
+func (s *StateMachine) Checkpoint() ([]byte, error) {
+	cp := checkpoint{Version: s.version, State: s.Name()}
+
+	for _, st := range s.definitions() {
+		for i, g := range st.guards {
+			gc, ok := g.(GuardCheckpointer)
+			if !ok {
+				continue
+			}
+
+			data, err := gc.CheckpointGuard()
+			if err != nil {
+				return nil, fmt.Errorf("Guard checkpoint failed: %v: %w", st.Destination, err)
+			}
+			cp.Guards = append(cp.Guards, guardCheckpoint{State: st.Destination, Index: i, Data: data})
+		}
+	}
+
+	return json.Marshal(cp)
+}
+
+// Version sets the machine version written to checkpoints.
+func (s *StateMachine) Version(v int) *StateMachine {
+	s.version = v
+	return s
+}
+
+// MachineVersion returns the machine version.
+func (s *StateMachine) MachineVersion() int {
+	return s.version
+}
+
+// RegisterMigration sets the function upgrading checkpoints of version from to
+// version to. Migrations are chained until the machine version is reached.
+func (s *StateMachine) RegisterMigration(from, to int, fn func([]byte) ([]byte, error)) {
+	if s.migrations == nil {
+		s.migrations = map[int]migration{}
+	}
+	s.migrations[from] = migration{to: to, fn: fn}
+}
+
+// migrate upgrades data written by version to the machine version.
+func (s *StateMachine) migrate(data []byte, version int) ([]byte, error) {
+	for steps := 0; version != s.version; steps++ {
+		m, ok := s.migrations[version]
+		if !ok || steps > len(s.migrations) {
+			return nil, fmt.Errorf("%w: %d > %d", ErrVersionMismatch, version, s.version)
+		}
+
+		migrated, err := m.fn(data)
+		if err != nil {
+			return nil, fmt.Errorf("Checkpoint migration failed: %d > %d: %w", version, m.to, err)
+		}
+		data, version = migrated, m.to
+	}
+	return data, nil
+}
+
+// RestoreCheckpoint loads data created by Checkpoint. The current state is set
+// directly, no OnEnter function is called. Checkpoints written by another
+// machine version are upgraded by the registered migrations, or refused. The
+// machine is left unchanged when the checkpoint can not be restored.
+func (s *StateMachine) RestoreCheckpoint(data []byte) error {
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return err
+	}
+
+	if cp.Version != s.version {
+		migrated, err := s.migrate(data, cp.Version)
+		if err != nil {
+			return err
+		}
+		cp = checkpoint{}
+		if err := json.Unmarshal(migrated, &cp); err != nil {
+			return err
+		}
+	}
+
+	var state *State
+	if cp.State != "" {
+		st, err := s.Find(cp.State)
+		if err != nil {
+			return err
+		}
+		state = st
+	}
+
+	// Every guard is looked up before any is restored, keeping the current
+	// data to roll back to.
+	guards := make([]GuardCheckpointer, 0, len(cp.Guards))
+	previous := make([][]byte, 0, len(cp.Guards))
+	for _, gc := range cp.Guards {
+		st, err := s.Find(gc.State)
+		if err != nil {
+			return err
+		}
+		if gc.Index < 0 || gc.Index >= len(st.guards) {
+			return fmt.Errorf("Invalid guard checkpoint: %v #%d", gc.State, gc.Index)
+		}
+
+		g, ok := st.guards[gc.Index].(GuardCheckpointer)
+		if !ok {
+			return fmt.Errorf("Invalid guard checkpoint: %v #%d", gc.State, gc.Index)
+		}
+		data, err := g.CheckpointGuard()
+		if err != nil {
+			return fmt.Errorf("Guard checkpoint failed: %v: %w", gc.State, err)
+		}
+		guards = append(guards, g)
+		previous = append(previous, data)
+	}
+
+	for i, g := range guards {
+		if err := g.RestoreGuard(cp.Guards[i].Data); err != nil {
+			for j := 0; j < i; j++ {
+				guards[j].RestoreGuard(previous[j])
+			}
+			return err
+		}
+	}
+
+	s.setState(state)
+	return nil
+}
+
+// ResumeAndReplay restores a checkpoint, then catches up by applying the state
+// changes recorded since. Replayed changes are validated like transitions but
+// no OnEnter functions are called. Replaying stops at the first invalid change,
+// the returned error names its index.
+func (s *StateMachine) ResumeAndReplay(checkpoint []byte, events []string) error {
+	if err := s.RestoreCheckpoint(checkpoint); err != nil {
+		return err
+	}
+
+	for i, name := range events {
+		if s.Match(name) {
+			continue
+		}
+
+		st, err := s.IsValidStateChange(name)
+		if err != nil {
+			return fmt.Errorf("Replay failed at event %d: %w", i, err)
+		}
+		s.setState(st)
+	}
+	return nil
+}
+
+// MarshalState serializes the current and previous state names.
+func (s *StateMachine) MarshalState() ([]byte, error) {
+	return json.Marshal(runtimeState{State: s.Name(), Previous: s.PreviousName()})
+}
+
+// RestoreState loads data created by MarshalState. The current and previous
+// states are set directly, no OnEnter or OnExit function is called.
+func (s *StateMachine) RestoreState(data []byte) error {
+	var rs runtimeState
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return err
+	}
+
+	var state, previous *State
+	if rs.State != "" {
+		st, err := s.Find(rs.State)
+		if err != nil {
+			return fmt.Errorf("Restoring current state failed: %w", err)
+		}
+		state = st
+	}
+	if rs.Previous != "" {
+		st, err := s.Find(rs.Previous)
+		if err != nil {
+			return fmt.Errorf("Restoring previous state failed: %w", err)
+		}
+		previous = st
+	}
+
+	s.setState(state)
+	s.mu.Lock()
+	s.previous = previous
+	s.mu.Unlock()
+	return nil
+}
+
+// setState makes st the current state without entering it.
+func (s *StateMachine) setState(st *State) {
+	if current := s.current(); current != nil && current.cancel != nil {
+		current.cancel()
+	}
+	if st != nil && s.ctx != nil {
+		st.ctx, st.cancel = context.WithCancel(s.ctx)
+	}
+	s.mu.Lock()
+	s.CurrentState = st
+	s.mu.Unlock()
+}
@@ -0,0 +1,166 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// retryGuard allows a limited number of entries.
+type retryGuard struct {
+	Used int
+	Max  int
+}
+
+func (g *retryGuard) Allow(from, to *State) bool {
+	return g.Used < g.Max
+}
+
+func (g *retryGuard) CheckpointGuard() ([]byte, error) {
+	return json.Marshal(g.Used)
+}
+
+func (g *retryGuard) RestoreGuard(data []byte) error {
+	return json.Unmarshal(data, &g.Used)
+}
+
+func newCheckpointMachine(g Guard) *StateMachine {
+	sm := New()
+	sm.NewState().From("retry").To("waiting")
+	sm.NewState().From("waiting").To("retry").GuardWith(g)
+	return sm
+}
+
+func TestCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Used: 2, Max: 3})
+	sm.CurrentState, _ = sm.Find("waiting")
+
+	data, err := sm.Checkpoint()
+	assert.Nil(err, "should not return an error")
+
+	g := &retryGuard{Max: 3}
+	restored := newCheckpointMachine(g)
+	err = restored.RestoreCheckpoint(data)
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal("waiting", restored.Name(), "should restore the current state")
+	assert.Equal(2, g.Used, "should restore the guard state")
+}
+
+func TestRestoreCheckpointInvalidState(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3})
+
+	err := sm.RestoreCheckpoint([]byte(`{"state":"missing"}`))
+
+	assert.EqualError(err, "Invalid state: missing", "should return an error when state does not exist")
+	assert.False(sm.Exists(), "should not change state")
+}
+
+func TestRestoreCheckpointPartial(t *testing.T) {
+	assert := assert.New(t)
+	first, second := &retryGuard{Used: 1, Max: 3}, &retryGuard{Max: 3}
+	sm := New()
+	sm.NewState().From("retry").To("waiting")
+	sm.NewState().From("waiting").To("retry").GuardWith(first).GuardWith(second)
+
+	// Data is base64 encoded, "Mg==" is 2 and "eA==" is not a number.
+	err := sm.RestoreCheckpoint([]byte(`{"state":"waiting","guards":[` +
+		`{"state":"retry","index":0,"data":"Mg=="},{"state":"retry","index":5,"data":"Mg=="}]}`))
+	assert.EqualError(err, "Invalid guard checkpoint: retry #5", "should reject unknown guards")
+	assert.Equal(1, first.Used, "should not restore guards before checking every one")
+	assert.False(sm.Exists(), "should not change state")
+
+	err = sm.RestoreCheckpoint([]byte(`{"state":"waiting","guards":[` +
+		`{"state":"retry","index":0,"data":"Mg=="},{"state":"retry","index":1,"data":"eA=="}]}`))
+	assert.NotNil(err, "should return the guard error")
+	assert.Equal(1, first.Used, "should roll back guards restored before the failure")
+	assert.False(sm.Exists(), "should not change state")
+}
+
+func TestRestoreCheckpointVersion(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3}).Version(1)
+	sm.CurrentState, _ = sm.Find("waiting")
+	data, _ := sm.Checkpoint()
+
+	restored := newCheckpointMachine(&retryGuard{Max: 3}).Version(2)
+	err := restored.RestoreCheckpoint(data)
+
+	assert.Equal(2, restored.MachineVersion(), "should return the machine version")
+	assert.EqualError(err, "Checkpoint version mismatch: 1 > 2", "should refuse checkpoints of another version")
+	assert.False(restored.Exists(), "should not change state")
+}
+
+func TestRestoreCheckpointMigration(t *testing.T) {
+	assert := assert.New(t)
+	restored := newCheckpointMachine(&retryGuard{Max: 3}).Version(3)
+	restored.RegisterMigration(1, 2, func(data []byte) ([]byte, error) {
+		return bytes.Replace(data, []byte(`"wait"`), []byte(`"waiting"`), 1), nil
+	})
+	restored.RegisterMigration(2, 3, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+
+	err := restored.RestoreCheckpoint([]byte(`{"version":1,"state":"wait"}`))
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal("waiting", restored.Name(), "should restore the migrated checkpoint")
+}
+
+func TestResumeAndReplay(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3})
+	sm.CurrentState, _ = sm.Find("waiting")
+	data, _ := sm.Checkpoint()
+
+	restored := newCheckpointMachine(&retryGuard{Max: 3})
+	err := restored.ResumeAndReplay(data, []string{"retry", "waiting", "retry"})
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal("retry", restored.Name(), "should apply the replayed changes")
+}
+
+func TestResumeAndReplayInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3})
+	sm.CurrentState, _ = sm.Find("waiting")
+	data, _ := sm.Checkpoint()
+
+	restored := newCheckpointMachine(&retryGuard{Max: 3})
+	err := restored.ResumeAndReplay(data, []string{"retry", "missing", "waiting"})
+
+	assert.EqualError(err, "Replay failed at event 1: Invalid state: missing", "should report the invalid event index")
+	assert.Equal("retry", restored.Name(), "should stop at the invalid event")
+}
+
+func TestMarshalState(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3})
+	sm.previous, _ = sm.Find("retry")
+	sm.CurrentState, _ = sm.Find("waiting")
+
+	data, err := sm.MarshalState()
+	assert.Nil(err, "should not return an error")
+	assert.JSONEq(`{"state":"waiting","previous":"retry"}`, string(data), "should serialize the current and previous state")
+
+	restored := newCheckpointMachine(&retryGuard{Max: 3})
+	err = restored.RestoreState(data)
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal("waiting", restored.Name(), "should restore the current state")
+	assert.Equal("retry", restored.PreviousName(), "should restore the previous state")
+}
+
+func TestRestoreStateInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sm := newCheckpointMachine(&retryGuard{Max: 3})
+
+	err := sm.RestoreState([]byte(`{"state":"missing"}`))
+
+	assert.EqualError(err, "Restoring current state failed: Invalid state: missing", "should name the missing state")
+	assert.False(sm.Exists(), "should not change state")
+}
@@ -0,0 +1,119 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// Clone returns a machine with a copy of the state definitions and the
+// configuration, but none of the runtime state: it has no current state,
+// context, history or statistics, and is not started. Guards and handler
+// functions are shared between the machines.
+func (s *StateMachine) Clone() *StateMachine {
+	c := New()
+	c.transitions = make(chan *Transition, cap(s.transitions))
+
+	c.eventFn = s.eventFn
+	c.beforeFn = s.beforeFn
+	c.afterFn = s.afterFn
+	c.beforeEFn = s.beforeEFn
+	c.onStart = s.onStart
+	c.completeFn = s.completeFn
+	c.defaultEnterFn = s.defaultEnterFn
+	c.defaultEnterMode = s.defaultEnterMode
+	c.filterFn = s.filterFn
+	c.compareFn = s.compareFn
+	c.unknownFn = s.unknownFn
+	c.invariants = append([]func(*StateMachine) error{}, s.invariants...)
+	c.invariantState = s.invariantState
+	s.historyMu.RLock()
+	c.retainFn = s.retainFn
+	s.historyMu.RUnlock()
+	c.version = s.version
+	c.stateIDs = s.stateIDs
+	c.middleware = append([]Middleware{}, s.middleware...)
+	c.blocking = s.blocking
+	c.nonBlocking = s.nonBlocking
+	c.overflowFn = s.overflowFn
+	c.sendTimeout = s.sendTimeout
+	c.stateExitFn = s.stateExitFn
+	c.stateDurationFn = s.stateDurationFn
+	c.logger = s.logger
+	if s.handlers != nil {
+		c.handlers = make(map[string]func(*State), len(s.handlers))
+		for name, f := range s.handlers {
+			c.handlers[name] = f
+		}
+	}
+
+	c.enterHooks = cloneHooks(s.enterHooks)
+	c.exitHooks = cloneHooks(s.exitHooks)
+
+	for _, group := range s.groups {
+		c.groups = append(c.groups, append([]string{}, group...))
+	}
+	if s.migrations != nil {
+		c.migrations = make(map[int]migration, len(s.migrations))
+		for from, m := range s.migrations {
+			c.migrations[from] = m
+		}
+	}
+	if s.latency != nil {
+		c.WithLatencyStats()
+	}
+	if s.coalescer != nil {
+		c.WithCoalescing()
+	}
+
+	for _, st := range s.definitions() {
+		c.States = append(c.States, st.clone(c))
+	}
+	s.defMu.RLock()
+	built := s.index != nil
+	s.defMu.RUnlock()
+	if built {
+		c.Build()
+	}
+	return c
+}
+
+// clone returns a copy of the state definition belonging to machine.
+func (st *State) clone(machine *StateMachine) *State {
+	c := *st
+	c.machine = machine
+	c.ctx, c.cancel = nil, nil
+	c.data = nil
+	if st.flags != nil {
+		c.flags = &stateFlags{}
+	}
+
+	c.Source = append([]string(nil), st.Source...)
+	c.except = append([]string(nil), st.except...)
+	c.sourcePatterns = append([]string(nil), st.sourcePatterns...)
+	c.roles = append([]string(nil), st.roles...)
+	c.triggers = append([]string(nil), st.triggers...)
+	c.guards = append([]Guard(nil), st.guards...)
+	if st.Meta != nil {
+		c.Meta = make(map[string]interface{}, len(st.Meta))
+		for key, val := range st.Meta {
+			c.Meta[key] = val
+		}
+	}
+	if st.internals != nil {
+		c.internals = make(map[string]func(*State), len(st.internals))
+		for event, action := range st.internals {
+			c.internals[event] = action
+		}
+	}
+	return &c
+}
+
+// cloneHooks returns a copy of hooks.
+func cloneHooks(hooks map[string][]func(*State)) map[string][]func(*State) {
+	if hooks == nil {
+		return nil
+	}
+	c := make(map[string][]func(*State), len(hooks))
+	for name, fns := range hooks {
+		c[name] = append([]func(*State){}, fns...)
+	}
+	return c
+}
@@ -0,0 +1,37 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	foo := sm.NewState().FromAny().To("foo").WithMeta("color", "red").OnEnter(func(*State) {})
+	sm.NewState().From("foo").To("bar")
+	sm.Transition("foo")
+
+	clone := sm.Clone()
+
+	assert.Len(clone.States, 2, "should copy the states")
+	assert.False(clone.Exists(), "should not copy the current state")
+	assert.Nil(clone.ctx, "should not copy the context")
+	assert.NotEqual(sm.transitions, clone.transitions, "should create a new transitions channel")
+
+	cloned, _ := clone.Find("foo")
+	assert.False(foo == cloned, "should copy the state definitions")
+	assert.Nil(cloned.Context(), "should not copy the state context")
+	assert.NotNil(cloned.onEnterFunc, "should copy the enter function")
+
+	clone.NewState().From("bar").To("baz")
+	cloned.From("baz")
+	cloned.WithMeta("color", "blue")
+
+	assert.Len(sm.States, 2, "should not share the states")
+	assert.Equal([]string(nil), foo.Source, "should not share the sources")
+	color, _ := foo.MetaValue("color")
+	assert.Equal("red", color, "should not share the metadata")
+}
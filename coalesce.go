@@ -0,0 +1,54 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "sync"
+
+// coalescer shares the result of concurrent transitions to the same target.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a transition in progress.
+type coalescedCall struct {
+	done chan struct{}
+	err  error
+}
+
+// WithCoalescing makes concurrent Transition calls to the same target share a
+// single attempt, every caller receives its result. Callers waiting for the
+// transition to execute, such as for states entered by OnEnterE, share the
+// result of the execution as well. Calls arriving once the
+// transition is committed are ignored as same state transitions anyway.
+// Only plain Transition calls are coalesced, calls passing roles, data or a
+// context, as well as TransitionSync and Fire, are attempted on their own.
+func (s *StateMachine) WithCoalescing() *StateMachine {
+	s.coalescer = &coalescer{calls: map[string]*coalescedCall{}}
+	return s
+}
+
+// do runs fn unless a call for the same target is in progress, in which case
+// it waits for that call and returns its result.
+func (c *coalescer) do(to string, fn func() error) error {
+	c.mu.Lock()
+	if call, ok := c.calls[to]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[to] = call
+	c.mu.Unlock()
+
+	call.err = fn()
+
+	c.mu.Lock()
+	delete(c.calls, to)
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
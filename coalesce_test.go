@@ -0,0 +1,126 @@
+package fsm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescer(t *testing.T) {
+	assert := assert.New(t)
+	c := &coalescer{calls: map[string]*coalescedCall{}}
+	release := make(chan bool)
+	failure := errors.New("failure")
+	calls := 0
+
+	var wg sync.WaitGroup
+	results := make([]error, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.do("foo", func() error {
+				calls++
+				<-release
+				return failure
+			})
+		}(i)
+	}
+
+	assert.Eventually(func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.calls) == 1
+	}, time.Second, time.Millisecond, "should register the call in progress")
+	close(release)
+	wg.Wait()
+
+	assert.Equal(1, calls, "should run the function once for concurrent calls")
+	for _, err := range results {
+		assert.Equal(failure, err, "should share the result with every caller")
+	}
+	assert.Empty(c.calls, "should forget the call once done")
+}
+
+func TestWithCoalescing(t *testing.T) {
+	assert := assert.New(t)
+	release := make(chan struct{})
+	entered := make(chan bool, 10)
+	sm := New().WithCoalescing()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnterE(func(*State) error {
+		entered <- true
+		<-release
+		return errors.New("boom")
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- sm.Transition("foo")
+		}()
+	}
+
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.EqualError(err, "boom", "should share the result of the handler")
+	}
+	assert.Len(entered, 0, "should enter the state once")
+}
+
+func TestWithCoalescingRoles(t *testing.T) {
+	assert := assert.New(t)
+	checking := make(chan bool)
+	release := make(chan bool)
+	var once sync.Once
+	sm := New().WithCoalescing()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").AllowSelf().RequireRole("admin").Guard(func(from, to *State) bool {
+		once.Do(func() {
+			checking <- true
+			<-release
+		})
+		return true
+	})
+
+	admin := make(chan error)
+	go func() {
+		admin <- sm.TransitionAs([]string{"admin"}, "foo")
+	}()
+	<-checking
+
+	guest := make(chan error)
+	go func() {
+		guest <- sm.TransitionAs([]string{"guest"}, "foo")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	assert.Nil(<-admin, "should not return an error")
+	assert.True(errors.Is(<-guest, ErrForbidden), "should not hand a rejected caller another caller's success")
+}
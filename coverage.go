@@ -0,0 +1,32 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// CallbackInfo describes the hooks wired to a state.
+type CallbackInfo struct {
+	// OnEnter is set when the state has its own enter function.
+	OnEnter bool
+	OnExit  bool
+	// DefaultEnter is set when the machine default enter function applies.
+	DefaultEnter bool
+	// ParallelIf is set when a function decides on parallel entry.
+	ParallelIf bool
+	Guards     int
+}
+
+// CallbackCoverage returns the hooks wired to every defined state, keyed by
+// destination. States defined more than once are merged.
+func (s *StateMachine) CallbackCoverage() map[string]CallbackInfo {
+	coverage := map[string]CallbackInfo{}
+	for _, st := range s.definitions() {
+		info := coverage[st.Destination]
+		info.OnEnter = info.OnEnter || st.onEnterFunc != nil
+		info.OnExit = info.OnExit || st.onExitFunc != nil
+		info.DefaultEnter = s.defaultEnterFn != nil
+		info.ParallelIf = info.ParallelIf || st.parallelFn != nil
+		info.Guards += len(st.guards)
+		coverage[st.Destination] = info
+	}
+	return coverage
+}
@@ -0,0 +1,25 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackCoverage(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	allow := GuardFunc(func(from, to *State) bool { return true })
+	sm.NewState().From("idle").To("sync").OnEnter(func(*State) {}).GuardWith(allow)
+	sm.NewState().From("sync").To("idle").OnExit(func(*State) {})
+	sm.NewState().From("error").To("sync").GuardWith(allow)
+
+	coverage := sm.CallbackCoverage()
+
+	assert.Equal(CallbackInfo{OnEnter: true, Guards: 2}, coverage["sync"], "should merge states defined more than once")
+	assert.Equal(CallbackInfo{OnExit: true}, coverage["idle"], "should report exit functions")
+	assert.Len(coverage, 2, "should only report destinations")
+
+	sm.DefaultOnEnter(func(*State) {})
+	assert.True(sm.CallbackCoverage()["idle"].DefaultEnter, "should report the default enter function")
+}
@@ -0,0 +1,105 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stateDefinition is the JSON representation of a state definition.
+type stateDefinition struct {
+	Destination    string                 `json:"destination"`
+	Pattern        bool                   `json:"pattern,omitempty"`
+	Sources        []string               `json:"sources,omitempty"`
+	SourcePatterns []string               `json:"sourcePatterns,omitempty"`
+	Except         []string               `json:"except,omitempty"`
+	FromAny        bool                   `json:"fromAny,omitempty"`
+	FromStart      bool                   `json:"fromStart,omitempty"`
+	Parent         string                 `json:"parent,omitempty"`
+	Parallel       bool                   `json:"parallel,omitempty"`
+	Final          bool                   `json:"final,omitempty"`
+	OnEnterRef     string                 `json:"onEnter,omitempty"`
+	OnExitRef      string                 `json:"onExit,omitempty"`
+	Meta           map[string]interface{} `json:"meta,omitempty"`
+}
+
+// LoadJSON returns a new machine with the states defined by data, a JSON array
+// as created by MarshalJSON. Functions are not part of the definition, states
+// reference them by name instead, see BindHandlers. Sources must name states
+// defined in data, or members of pattern states.
+func LoadJSON(data []byte) (*StateMachine, error) {
+	var defs []stateDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+
+	s := New()
+	for _, def := range defs {
+		st := s.NewState().From(def.Sources...).Parallel(def.Parallel)
+		if def.Pattern {
+			st.ToPattern(def.Destination)
+		} else {
+			st.To(def.Destination)
+		}
+		for _, glob := range def.SourcePatterns {
+			st.FromPattern(glob)
+		}
+		if len(def.Except) > 0 {
+			st.ExceptFrom(def.Except...)
+		}
+		if def.Parent != "" {
+			st.Parent(def.Parent)
+		}
+		for key, val := range def.Meta {
+			st.WithMeta(key, val)
+		}
+		if def.FromAny {
+			st.FromAny()
+		}
+		if def.FromStart {
+			st.FromStart()
+		}
+		if def.Final {
+			st.Final()
+		}
+		st.OnEnterRef(def.OnEnterRef).OnExitRef(def.OnExitRef)
+	}
+
+	for _, st := range s.definitions() {
+		for _, src := range st.Source {
+			if len(s.findDefinitions(src)) == 0 && s.findPattern(src) == nil {
+				return nil, fmt.Errorf("Unknown source: %v > %v", src, st.Destination)
+			}
+		}
+	}
+	return s, nil
+}
+
+// MarshalJSON returns the state definitions as a JSON array, which LoadJSON
+// turns into a machine again. Functions and the runtime state are not included,
+// nor are options such as events, roles, timeouts, throttling and retries.
+// Meta values are encoded as JSON, so they load as JSON types, numbers as
+// float64 for instance.
+func (s *StateMachine) MarshalJSON() ([]byte, error) {
+	defs := make([]stateDefinition, 0, len(s.definitions()))
+	for _, st := range s.definitions() {
+		defs = append(defs, stateDefinition{
+			Destination:    st.Destination,
+			Pattern:        st.isPattern,
+			Sources:        st.Source,
+			SourcePatterns: st.sourcePatterns,
+			Except:         st.except,
+			FromAny:        st.fromAny,
+			FromStart:      st.fromStart,
+			Parent:         st.parent,
+			Parallel:       st.parallel,
+			Final:          st.final,
+			OnEnterRef:     st.onEnterRef,
+			OnExitRef:      st.onExitRef,
+			Meta:           st.Meta,
+		})
+	}
+	return json.Marshal(defs)
+}
@@ -0,0 +1,79 @@
+package fsm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadJSON(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte(`[
+		{"destination": "draft", "fromStart": true},
+		{"destination": "review", "sources": ["draft"], "parallel": true},
+		{"destination": "published", "sources": ["review"], "final": true},
+		{"destination": "archived", "fromAny": true}
+	]`)
+
+	sm, err := LoadJSON(data)
+	assert.Nil(err)
+	assert.Len(sm.States, 4, "should define every state")
+
+	review, err := sm.Find("review")
+	assert.Nil(err)
+	assert.Equal([]string{"draft"}, review.Source)
+	assert.True(review.parallel, "should load the parallel flag")
+
+	published, _ := sm.Find("published")
+	assert.True(published.final, "should load the final flag")
+
+	out, err := json.Marshal(sm)
+	assert.Nil(err)
+	loaded, err := LoadJSON(out)
+	assert.Nil(err)
+	again, err := json.Marshal(loaded)
+	assert.Nil(err)
+	assert.JSONEq(string(out), string(again), "should round trip the definition")
+}
+
+func TestLoadJSONPatterns(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().ExceptFrom("done").To("idle").WithMeta("label", "Idle")
+	sm.NewState().From("idle").ToPattern("worker:*").Parent("busy")
+	sm.NewState().FromPattern("worker:*").To("done")
+	sm.NewState().To("busy")
+
+	out, err := json.Marshal(sm)
+	assert.Nil(err)
+	loaded, err := LoadJSON(out)
+	assert.Nil(err)
+
+	worker, err := loaded.Find("worker:3")
+	assert.Nil(err, "should load pattern states")
+	assert.Equal("worker:3", worker.Destination, "should match names against the pattern")
+	assert.Equal("busy", worker.parent, "should load the parent")
+
+	done, _ := loaded.Find("done")
+	assert.Equal([]string{"worker:*"}, done.sourcePatterns, "should load source patterns")
+
+	idle, _ := loaded.Find("idle")
+	assert.Equal([]string{"done"}, idle.except, "should load excluded sources")
+	label, _ := idle.MetaValue("label")
+	assert.Equal("Idle", label, "should load meta values")
+
+	again, err := json.Marshal(loaded)
+	assert.Nil(err)
+	assert.JSONEq(string(out), string(again), "should round trip the definition")
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := LoadJSON([]byte(`{"destination": "draft"`))
+	assert.NotNil(err, "should reject malformed JSON")
+
+	_, err = LoadJSON([]byte(`[{"destination": "review", "sources": ["draft"]}]`))
+	assert.EqualError(err, "Unknown source: draft > review", "should reject undefined sources")
+}
@@ -0,0 +1,35 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "fmt"
+
+// DryRun checks that the sequence of states could be entered one after the
+// other, starting from the current state, without changing the machine or
+// calling any functions of it. Only the source rules and the machine filter are
+// checked, as guards depend on the data at transition time. Staying in the
+// state already reached is accepted, like Transition does. The first problem
+// is returned along with the index of the step in the sequence.
+func (s *StateMachine) DryRun(sequence ...string) error {
+	from := s.current()
+	for i, name := range sequence {
+		st, err := s.Find(name)
+		if err != nil {
+			return fmt.Errorf("Step %d: %w", i, err)
+		}
+		if from != nil && s.equal(from.Destination, name) && !st.allowSelf {
+			continue
+		}
+
+		fromName := from.name()
+		if !s.permitsSource(from, st) {
+			return fmt.Errorf("Step %d: Invalid state change: %v > %v", i, fromName, st.Destination)
+		}
+		if s.filterFn != nil && !s.filterFn(fromName, st.Destination) {
+			return fmt.Errorf("Step %d: %w: %v > %v", i, ErrFiltered, fromName, st.Destination)
+		}
+		from = st
+	}
+	return nil
+}
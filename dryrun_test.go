@@ -0,0 +1,41 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := 0
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("draft").OnEnter(func(*State) {
+		entered++
+	})
+	sm.NewState().From("draft").To("review")
+	sm.NewState().From("review").To("published")
+
+	assert.Nil(sm.DryRun("draft", "review", "review", "published"), "should accept legal sequences")
+	assert.EqualError(sm.DryRun("draft", "published"), "Step 1: Invalid state change: draft > published", "should report the failing step")
+	assert.True(errors.Is(sm.DryRun("draft", "unknown"), ErrInvalidState), "should report unknown states")
+	assert.False(sm.Exists(), "should not change the machine")
+	assert.Equal(0, entered, "should not call any functions")
+
+	assert.Nil(sm.TransitionSync("draft"))
+	assert.EqualError(sm.DryRun("published"), "Step 0: Invalid state change: draft > published", "should start from the current state")
+
+	sm.SetTransitionFilter(func(from, to string) bool {
+		return to != "published"
+	})
+	assert.True(errors.Is(sm.DryRun("review", "published"), ErrFiltered), "should apply the machine filter")
+}
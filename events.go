@@ -0,0 +1,80 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// eventsBuffer is the capacity of the events channel.
+const eventsBuffer = 16
+
+// EventKind identifies a machine lifecycle event.
+type EventKind int
+
+const (
+	// Started is emitted when the start state is entered.
+	Started EventKind = iota
+	// Transitioned is emitted when a transition is committed.
+	Transitioned
+	// Rejected is emitted when a transition is refused.
+	Rejected
+	// Paused is emitted when transition execution is paused.
+	Paused
+	// Resumed is emitted when transition execution resumes.
+	Resumed
+	// Stopped is emitted when the machine is stopped.
+	Stopped
+	// Finished is emitted when a final state is committed.
+	Finished
+)
+
+var eventKindNames = map[EventKind]string{
+	Started:      "Started",
+	Transitioned: "Transitioned",
+	Rejected:     "Rejected",
+	Paused:       "Paused",
+	Resumed:      "Resumed",
+	Stopped:      "Stopped",
+	Finished:     "Finished",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// Event describes something that happened to the machine.
+type Event struct {
+	Kind EventKind
+	// State is the name of the current state when the event occurred.
+	State string
+	// Transition is set for Transitioned and Finished events.
+	Transition *Transition
+	// To is the requested state of Rejected events.
+	To string
+	// Err is the reason of Rejected events.
+	Err error
+}
+
+// Events returns the channel receiving machine lifecycle events. It is buffered
+// and events are dropped while the buffer is full.
+func (s *StateMachine) Events() <-chan Event {
+	return s.events
+}
+
+// OnEvent sets a function to be called with every lifecycle event.
+func (s *StateMachine) OnEvent(f func(Event)) {
+	s.eventFn = f
+}
+
+// emit publishes an event without blocking.
+func (s *StateMachine) emit(e Event) {
+	if s.eventFn != nil {
+		s.eventFn(e)
+	}
+
+	select {
+	case s.events <- e:
+	default:
+	}
+}
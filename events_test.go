@@ -0,0 +1,45 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	kinds := []EventKind{}
+
+	sm.OnEvent(func(e Event) {
+		kinds = append(kinds, e.Kind)
+	})
+	sm.OnStart(func(*State) {})
+	sm.NewState().FromStart().To("foo")
+	sm.NewState().From("foo").To("bar").Final()
+
+	sm.Start()
+	sm.Transition("bar")
+	sm.Transition("foo")
+	sm.Transition("bar")
+	sm.Pause()
+	sm.Resume()
+	sm.Stop()
+
+	assert.Equal([]EventKind{Started, Rejected, Transitioned, Transitioned, Finished, Paused, Resumed, Stopped}, kinds, "should emit lifecycle events")
+
+	e := <-sm.Events()
+	assert.Equal(Started, e.Kind, "should send events to the channel")
+	e = <-sm.Events()
+	assert.Equal(Rejected, e.Kind, "should send events in order")
+	assert.Equal("bar", e.To, "should name the rejected state")
+	assert.EqualError(e.Err, "Invalid state change:  > bar", "should include the rejection reason")
+}
+
+func TestEventKindString(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("Transitioned", Transitioned.String(), "should name the kind")
+	assert.Equal("Unknown", EventKind(-1).String(), "should handle unknown kinds")
+}
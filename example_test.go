@@ -0,0 +1,53 @@
+package fsm_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/edge/fsm"
+)
+
+type Order struct {
+	ID    string
+	Items int
+}
+
+func ExamplePayloadFromContext() {
+	sm := fsm.New()
+
+	sm.NewState().To("processing").OnEnter(func(st *fsm.State) {
+		if order, ok := fsm.PayloadFromContext[*Order](st.Context()); ok {
+			fmt.Printf("processing order %s with %d items\n", order.ID, order.Items)
+		}
+	})
+
+	ctx := fsm.ContextWithPayload(context.Background(), &Order{ID: "A-1", Items: 3})
+	sm.TransitionCtx(ctx, "processing")
+
+	// Execute the queued transition.
+	sm.ProcessNext()
+
+	// Output: processing order A-1 with 3 items
+}
+
+type OrderContext struct {
+	ID       string
+	Customer string
+}
+
+func ExampleTypedMachine() {
+	sm := fsm.NewTyped[OrderContext]()
+
+	sm.NewState().FromAny().To("shipped").OnEnter(func(st *fsm.TypedState[OrderContext]) {
+		if order, ok := st.Data(); ok {
+			fmt.Printf("shipped order %s to %s\n", order.ID, order.Customer)
+		}
+	})
+
+	sm.TransitionWith("shipped", OrderContext{ID: "A-1", Customer: "Alice"})
+
+	// Execute the queued transition.
+	sm.ProcessNext()
+
+	// Output: shipped order A-1 to Alice
+}
@@ -0,0 +1,188 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// anyName is the node edges of FromAny states start from in exported graphs.
+const anyName = "*"
+
+// edge is a source to destination pair of the state graph.
+type edge struct {
+	from, to string
+}
+
+// edges returns every source to destination pair once, in definition order.
+// FromAny states get an edge from anyName, FromStart states from StartName.
+func (s *StateMachine) edges() []edge {
+	edges := []edge{}
+	seen := map[edge]bool{}
+	add := func(e edge) {
+		if !seen[e] {
+			seen[e] = true
+			edges = append(edges, e)
+		}
+	}
+
+	for _, st := range s.definitions() {
+		if st.fromAny {
+			add(edge{anyName, st.Destination})
+		}
+		if st.fromStart {
+			add(edge{StartName, st.Destination})
+		}
+		for _, src := range st.Source {
+			add(edge{src, st.Destination})
+		}
+	}
+	return edges
+}
+
+// ExportDOT returns the state graph in the Graphviz DOT language. FromAny states
+// have a dashed edge from a "*" node, FromStart states an edge from the
+// "<start>" node. State metadata becomes node attributes.
+func (s *StateMachine) ExportDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph fsm {\n")
+
+	for _, st := range s.definedStates() {
+		fmt.Fprintf(&b, "\t%s%s;\n", dotQuote(st.Destination), dotAttrs(st.Meta))
+	}
+
+	for _, e := range s.edges() {
+		attrs := ""
+		if e.from == anyName {
+			attrs = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s%s;\n", dotQuote(e.from), dotQuote(e.to), attrs)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ExportMermaid returns the state graph as a Mermaid stateDiagram-v2. FromStart
+// states are entered from [*], final states lead to [*], and FromAny states
+// have an edge from every other state. States with an OnEnter function get a
+// note. Names Mermaid does not accept as identifiers, such as names with
+// spaces, are declared as descriptions of generated identifiers.
+func (s *StateMachine) ExportMermaid() string {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+
+	states := s.definedStates()
+	edges := s.edges()
+	names := []string{}
+	for _, st := range states {
+		names = append(names, st.Destination)
+	}
+	for _, e := range edges {
+		if e.from != StartName && e.from != anyName {
+			names = append(names, e.from)
+		}
+	}
+	id := mermaidIDs(&b, names)
+
+	for _, e := range edges {
+		switch e.from {
+		case StartName:
+			fmt.Fprintf(&b, "    [*] --> %s\n", id[e.to])
+		case anyName:
+			for _, st := range states {
+				if st.Destination != e.to {
+					fmt.Fprintf(&b, "    %s --> %s\n", id[st.Destination], id[e.to])
+				}
+			}
+		default:
+			fmt.Fprintf(&b, "    %s --> %s\n", id[e.from], id[e.to])
+		}
+	}
+
+	for _, st := range states {
+		if st.final {
+			fmt.Fprintf(&b, "    %s --> [*]\n", id[st.Destination])
+		}
+	}
+	for _, st := range states {
+		if st.onEnterFunc != nil {
+			fmt.Fprintf(&b, "    note right of %s: OnEnter\n", id[st.Destination])
+		}
+	}
+	return b.String()
+}
+
+// mermaidIDs returns the Mermaid identifier of every name. Names that are not
+// valid identifiers get a generated one, declared in b with the name as its
+// description.
+func mermaidIDs(b *strings.Builder, names []string) map[string]string {
+	taken := map[string]bool{}
+	for _, name := range names {
+		taken[name] = true
+	}
+
+	ids := map[string]string{}
+	n := 0
+	for _, name := range names {
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		if mermaidPlain(name) {
+			ids[name] = name
+			continue
+		}
+
+		id := fmt.Sprintf("s%d", n)
+		for taken[id] {
+			n++
+			id = fmt.Sprintf("s%d", n)
+		}
+		n++
+		taken[id] = true
+		ids[name] = id
+		fmt.Fprintf(b, "    state \"%s\" as %s\n", strings.ReplaceAll(name, `"`, "#quot;"), id)
+	}
+	return ids
+}
+
+// mermaidPlain returns true when name can be used as a Mermaid identifier.
+func mermaidPlain(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// dotAttrs returns meta as a DOT attribute list, sorted by key.
+func dotAttrs(meta map[string]interface{}) string {
+	if len(meta) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]string, len(keys))
+	for i, key := range keys {
+		attrs[i] = dotQuote(key) + "=" + dotQuote(fmt.Sprint(meta[key]))
+	}
+	return " [" + strings.Join(attrs, ", ") + "]"
+}
+
+// dotQuote returns name as a quoted DOT identifier.
+func dotQuote(name string) string {
+	name = strings.ReplaceAll(name, `\`, `\\`)
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
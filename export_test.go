@@ -0,0 +1,171 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportDOT(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().From("off").To("on")
+	sm.NewState().From("on").To("off").WithMeta("label", "Off").WithMeta("color", "grey")
+	sm.NewState().FromAny().To(`say "hi"`)
+
+	nodes, edges, err := parseDOT(sm.ExportDOT())
+	if !assert.NoError(err, "should parse back") {
+		return
+	}
+	assert.Equal(map[string]map[string]string{
+		"on":       {},
+		"off":      {"color": "grey", "label": "Off"},
+		`say "hi"`: {},
+	}, nodes, "should add a node per state with metadata as attributes")
+	assert.Equal(map[string]map[string]string{
+		"off -> on":     {},
+		"<start> -> on": {},
+		"on -> off":     {},
+		`* -> say "hi"`: {"style": "dashed"},
+	}, edges, "should add every edge")
+}
+
+// parseDOT parses the digraphs written by ExportDOT, returning the attributes
+// of every node and edge. Edges are keyed as "from -> to".
+func parseDOT(dot string) (map[string]map[string]string, map[string]map[string]string, error) {
+	if !strings.HasPrefix(dot, "digraph fsm {\n") || !strings.HasSuffix(dot, "}\n") {
+		return nil, nil, fmt.Errorf("missing digraph block")
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(dot, "digraph fsm {\n"), "}\n")
+
+	nodes := map[string]map[string]string{}
+	edges := map[string]map[string]string{}
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "\t") || !strings.HasSuffix(line, ";\n") {
+			return nil, nil, fmt.Errorf("malformed statement %q", line)
+		}
+		stmt := strings.TrimSuffix(strings.TrimPrefix(line, "\t"), ";\n")
+
+		from, rest, err := parseDOTID(stmt)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, target := from, nodes
+		if strings.HasPrefix(rest, " -> ") {
+			var to string
+			if to, rest, err = parseDOTID(strings.TrimPrefix(rest, " -> ")); err != nil {
+				return nil, nil, err
+			}
+			key, target = from+" -> "+to, edges
+		}
+
+		attrs := map[string]string{}
+		if rest != "" {
+			if !strings.HasPrefix(rest, " [") {
+				return nil, nil, fmt.Errorf("unexpected %q", rest)
+			}
+			rest = strings.TrimPrefix(rest, " [")
+			for {
+				var name, value string
+				if name, rest, err = parseDOTID(rest); err != nil {
+					return nil, nil, err
+				}
+				if !strings.HasPrefix(rest, "=") {
+					return nil, nil, fmt.Errorf("missing attribute value in %q", stmt)
+				}
+				if value, rest, err = parseDOTID(rest[1:]); err != nil {
+					return nil, nil, err
+				}
+				attrs[name] = value
+				if strings.HasPrefix(rest, ", ") {
+					rest = rest[2:]
+					continue
+				}
+				if rest != "]" {
+					return nil, nil, fmt.Errorf("unterminated attributes in %q", stmt)
+				}
+				break
+			}
+		}
+		if _, ok := target[key]; ok {
+			return nil, nil, fmt.Errorf("duplicate statement %q", stmt)
+		}
+		target[key] = attrs
+	}
+	return nodes, edges, nil
+}
+
+// parseDOTID parses a quoted or bare DOT identifier at the start of s.
+func parseDOTID(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		i := 0
+		for i < len(s) && (s[i] == '_' || s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+			i++
+		}
+		if i == 0 {
+			return "", "", fmt.Errorf("expected identifier at %q", s)
+		}
+		return s[:i], s[i:], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", fmt.Errorf("unterminated string %q", s)
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %q", s)
+}
+
+func TestExportMermaid(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft").To("review").OnEnter(func(*State) {})
+	sm.NewState().FromAny().To("closed").Final()
+
+	expected := `stateDiagram-v2
+    [*] --> draft
+    draft --> review
+    draft --> closed
+    review --> closed
+    closed --> [*]
+    note right of review: OnEnter
+`
+
+	assert.Equal(expected, sm.ExportMermaid(), "should match the golden diagram")
+}
+
+func TestExportMermaidNames(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().To("in review")
+	sm.NewState().From("in review").To(`say "hi"`)
+	sm.NewState().From(`say "hi"`).To("s0[x]").Final()
+
+	expected := `stateDiagram-v2
+    state "in review" as s0
+    state "say #quot;hi#quot;" as s1
+    state "s0[x]" as s2
+    [*] --> s0
+    s0 --> s1
+    s1 --> s2
+    s2 --> [*]
+`
+
+	assert.Equal(expected, sm.ExportMermaid(), "should declare names that are not identifiers")
+}
@@ -0,0 +1,111 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrNoTransition is returned when firing an event no state is entered by
+	// from the current state.
+	ErrNoTransition = errors.New("No transition for event")
+	// ErrNotResolved is returned when firing an event whose Resolve function
+	// finds no destination.
+	ErrNotResolved = errors.New("No destination resolved for event")
+)
+
+// On declares an event leading to the state. The same event can lead to
+// different states depending on their sources.
+func (st *State) On(event string) *State {
+	st.triggers = append(st.triggers, event)
+	return st
+}
+
+// Internal handles event while the state is current by calling action, without
+// leaving the state. No exit or enter functions are called.
+func (st *State) Internal(event string, action func(*State)) *State {
+	if st.internals == nil {
+		st.internals = map[string]func(*State){}
+	}
+	st.internals[event] = action
+	return st
+}
+
+// Resolve makes the state a choice between destinations when fired: instead of
+// entering the state, Fire transitions to the destination f returns for the
+// current state. Returning false rejects the event with ErrNotResolved.
+func (st *State) Resolve(f func(from *State) (to string, ok bool)) *State {
+	st.resolveFn = f
+	return st
+}
+
+// Priority sets the precedence of the state when several states are entered
+// by the same event, see Fire. States default to priority 0.
+func (st *State) Priority(p int) *State {
+	st.priority = p
+	return st
+}
+
+// Fire transitions to the state with the highest priority entered by event from
+// the current state. States of equal priority are tried in definition order.
+// When the guards of a state reject the transition, the next state is tried, so
+// a guarded state can take precedence over a generic fallback. The last guard
+// rejection is sent to the Errors channel too when no state can be entered.
+// Events handled internally by the current state take precedence.
+func (s *StateMachine) Fire(event string) error {
+	current := s.current()
+	if current != nil {
+		if action, ok := current.internals[event]; ok {
+			action(current)
+			return nil
+		}
+	}
+
+	candidates := []*State{}
+	for _, st := range s.definitions() {
+		if st.triggeredBy(event) && s.permitsSource(current, st) {
+			candidates = append(candidates, st)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("%w '%v' from state '%v'", ErrNoTransition, event, current.name())
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].priority > candidates[j].priority
+	})
+
+	var err error
+	for _, st := range candidates {
+		// The state declaring the event is entered, even when its name is
+		// defined again with other sources.
+		req := transitionRequest{to: st.Destination, state: st}
+		if st.resolveFn != nil {
+			resolved, ok := st.resolveFn(current)
+			if !ok {
+				return fmt.Errorf("%w '%v' from state '%v'", ErrNotResolved, event, current.name())
+			}
+			req = transitionRequest{to: resolved}
+		}
+
+		err = s.transition(req)
+		if !errors.Is(err, ErrGuardRejected) {
+			return err
+		}
+	}
+	s.emitError(err)
+	return err
+}
+
+// triggeredBy returns true when event was declared with On.
+func (st *State) triggeredBy(event string) bool {
+	for _, e := range st.triggers {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFire(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().From("draft").To("review").On("submit")
+	sm.NewState().From("review").To("published").On("approve")
+	sm.NewState().From("review").To("draft").On("reject")
+	sm.NewState().From("published").To("archived").On("approve")
+
+	sm.Transition("draft")
+	assert.Nil(sm.Fire("submit"), "should not return an error")
+	assert.Equal("review", sm.Name(), "should transition to the state entered by the event")
+
+	assert.Nil(sm.Fire("reject"), "should not return an error")
+	assert.Equal("draft", sm.Name(), "should return to draft on reject")
+	assert.Nil(sm.Fire("submit"), "should not return an error")
+
+	assert.Nil(sm.Fire("approve"), "should not return an error")
+	assert.Equal("published", sm.Name(), "should pick the state permitting the current state as source")
+
+	assert.Nil(sm.Fire("approve"), "should not return an error")
+	assert.Equal("archived", sm.Name(), "should resolve the same event by current state")
+}
+
+func TestFireNoTransition(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().From("review").To("published").On("approve")
+
+	sm.Transition("draft")
+	err := sm.Fire("approve")
+
+	assert.True(errors.Is(err, ErrNoTransition), "should return ErrNoTransition")
+	assert.EqualError(err, "No transition for event 'approve' from state 'draft'", "should name the event and state")
+	assert.Equal("draft", sm.Name(), "should not change state")
+}
+
+func TestFireGuardRejected(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().From("draft").To("review").On("submit").Guard(func(from, to *State) bool {
+		return false
+	})
+
+	sm.Transition("draft")
+	<-sm.Transitions()
+	err := sm.Fire("submit")
+
+	assert.True(errors.Is(err, ErrGuardRejected), "should return the guard rejection")
+	assert.Equal(err, <-sm.Errors(), "should send the guard rejection to the errors channel")
+}
+
+func TestFireInternal(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithHistoryStore(NewMemoryHistory(0))
+	entered := 0
+	refreshed := 0
+
+	list := sm.NewState().FromAny().To("list").OnEnter(func(*State) {
+		entered++
+	}).Internal("refresh", func(*State) {
+		refreshed++
+	})
+	sm.NewState().From("list").To("loading").On("refresh")
+
+	sm.Transition("list")
+	(<-sm.Transitions()).Do()
+	err := sm.Fire("refresh")
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal(1, refreshed, "should call the internal action")
+	assert.Equal(1, entered, "should not enter the state again")
+	assert.Equal(list, sm.CurrentState, "should stay in the state")
+	assert.Equal(0, sm.QueueDepth(), "should not send a transition")
+	history, _ := sm.history.All()
+	assert.Len(history, 1, "should not record history")
+}
+
+func TestFirePriority(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	vip := false
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("queued")
+	sm.NewState().From("queued").To("standard").On("serve")
+	sm.NewState().From("queued").To("express").On("serve").Priority(1).Guard(func(from, to *State) bool {
+		return vip
+	})
+	sm.NewState().From("queued").To("manual").On("serve")
+
+	sm.Transition("queued")
+	assert.Nil(sm.Fire("serve"))
+	assert.True(sm.Match("standard"), "should fall back when the guard rejects, in definition order")
+
+	vip = true
+	sm.Transition("queued")
+	assert.Nil(sm.Fire("serve"))
+	assert.True(sm.Match("express"), "should prefer the state with the highest priority")
+}
+
+func TestFireResolve(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	amount := 0
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("submitted")
+	sm.NewState().From("submitted").To("approved")
+	sm.NewState().From("submitted").To("review")
+	sm.NewState().From("submitted").To("check").On("decide").Resolve(func(from *State) (string, bool) {
+		switch {
+		case amount < 0:
+			return "", false
+		case amount > 100:
+			return "review", true
+		default:
+			return "approved", true
+		}
+	})
+
+	sm.Transition("submitted")
+	amount = 500
+	assert.Nil(sm.Fire("decide"))
+	assert.True(sm.Match("review"), "should enter the resolved destination")
+
+	sm.Transition("submitted")
+	amount = 50
+	assert.Nil(sm.Fire("decide"))
+	assert.True(sm.Match("approved"), "should enter the resolved destination")
+
+	sm.Transition("submitted")
+	amount = -1
+	err := sm.Fire("decide")
+	assert.True(errors.Is(err, ErrNotResolved), "should reject unresolved events")
+	assert.EqualError(err, "No destination resolved for event 'decide' from state 'submitted'")
+	assert.True(sm.Match("submitted"))
+}
@@ -5,18 +5,159 @@ package fsm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	// ErrInvalidState is returned when a state name is not defined.
+	ErrInvalidState = errors.New("Invalid state")
+	// ErrInvalidStateChange is returned when a state does not permit the change
+	// from the current state.
+	ErrInvalidStateChange = errors.New("Invalid state change")
+	// ErrFiltered is returned when the machine wide transition filter rejects a transition.
+	ErrFiltered = errors.New("Transition filtered")
+	// ErrStateBusy is returned when entering an exclusive state whose handler is still running.
+	ErrStateBusy = errors.New("State busy")
+	// ErrForbidden is returned when the caller lacks a role required by the inbound state.
+	ErrForbidden = errors.New("Forbidden transition")
+	// ErrStateChanged is returned when committing a proposal after the state changed.
+	ErrStateChanged = errors.New("State changed")
+	// ErrMissingOnStart is returned when starting a machine without an OnStart function.
+	ErrMissingOnStart = errors.New("Missing OnStart function")
+	// ErrAmbiguousState is returned when more than one definition of a state
+	// permits the change from the current state.
+	ErrAmbiguousState = errors.New("Ambiguous state")
+	// ErrPanic is sent to the errors channel when a handler panics.
+	ErrPanic = errors.New("Handler panicked")
+	// ErrStopped is returned when transitioning a stopped machine.
+	ErrStopped = errors.New("State machine stopped")
+	// ErrUnregisteredHandler is returned when binding a handler name that was
+	// never registered.
+	ErrUnregisteredHandler = errors.New("Handler not registered")
+	// ErrContextDone is returned when transitioning after the machine context
+	// is done.
+	ErrContextDone = errors.New("State machine context done")
+)
+
+// StartName is reported as the initial state name of machines entering the
+// start state through Start.
+const StartName = "<start>"
+
+// Unbuffered is the buffer size passed to NewWithBuffer for a transitions
+// channel without buffer.
+const Unbuffered = -1
+
+// errorsBuffer is the capacity of the errors channel.
+const errorsBuffer = 16
+
 // StateMachine is the finite state machine struct.
 type StateMachine struct {
+	// CurrentState is the state the machine is in. Use Snapshot to inspect it
+	// without sharing the definition.
 	CurrentState *State
-	States       []*State
-	transitions  chan *Transition
+	// previous is the state left by the last committed transition.
+	previous *State
+	// mu guards CurrentState, previous and initial, transitionMu serializes
+	// transitions.
+	mu           sync.RWMutex
+	transitionMu sync.Mutex
+	// defMu guards States and index, as states resolved by OnUnknownState are
+	// added while the machine runs.
+	defMu       sync.RWMutex
+	States      []*State
+	transitions chan *Transition
+	errors      chan error
+	events      chan Event
+	eventFn     func(Event)
 	// beforeFn runs before the state change.
 	beforeFn func(*Transition)
 	// afterFn runs after the state is change.
 	afterFn func(*Transition)
+	// beforeEFn can veto transitions before they are executed.
+	beforeEFn func(*Transition) error
+	// onStart runs when the machine enters its start state.
+	onStart func(*State)
+	// completeFn runs when a final state has been entered.
+	completeFn func(*State)
+	// defaultEnterFn runs when entering states, as configured by defaultEnterMode.
+	defaultEnterFn   func(*State)
+	defaultEnterMode DefaultEnterMode
+	// filterFn is consulted for every transition that passes the state rules.
+	filterFn func(from, to string) bool
+	// compareFn decides whether two state names are equal.
+	compareFn func(a, b string) bool
+	// unknownFn resolves states missing from the definition.
+	unknownFn func(name string) (*State, error)
+	// latency records guard and handler timings when set.
+	latency *latencyTracker
+	// groups lists the exclusive state groups.
+	groups [][]string
+	// invariants are checked after every committed transition.
+	invariants     []func(*StateMachine) error
+	invariantState string
+
+	// index is the optional lookup table created by Build.
+	index *stateIndex
+	// history stores committed transitions when set, historyMu guards it
+	// along with retainFn.
+	historyMu sync.RWMutex
+	history   HistoryStore
+	retainFn  func(*Transition) bool
+	// version is written to checkpoints, migrations upgrade older ones.
+	version    int
+	migrations map[int]migration
+	// coalescer is set by WithCoalescing.
+	coalescer  *coalescer
+	middleware []Middleware
+	// blocking makes every transition wait until executed.
+	blocking bool
+	// nonBlocking drops transitions when the queue is full.
+	nonBlocking bool
+	overflowFn  func(*Transition)
+	dropped     uint64
+	// sendTimeout limits waiting for the executor to accept a transition.
+	sendTimeout time.Duration
+
+	observersMu sync.Mutex
+	observers   []*observer
+	subscribers []*subscriber
+
+	pauser *pauser
+
+	logger Logger
+
+	// stateIDs and transitionIDs are the last IDs assigned.
+	stateIDs      int
+	transitionIDs uint64
+
+	// handlers are the functions states can reference by name.
+	handlers map[string]func(*State)
+	// enterHooks and exitHooks hold the OnEnterState and OnExitState functions
+	// by destination.
+	enterHooks map[string][]func(*State)
+	exitHooks  map[string][]func(*State)
+
+	// start is the pseudo state entered by Start.
+	start   *State
+	started int32
+	stopped int32
+	// initial is the name of the first state the machine entered, guarded by
+	// mu.
+	initial string
+	// enteredAt is the time the current state was entered.
+	clockMu     sync.Mutex
+	enteredAt   time.Time
+	stateExitFn func(name string, duration time.Duration)
+	// stateDurationFn is set by OnStateDuration.
+	stateDurationFn func(state string, d time.Duration)
+	// counts holds the number of committed transitions per edge.
+	countsMu sync.Mutex
+	counts   map[TransitionKey]int
 
 	initialized bool
 	ctx         context.Context
@@ -25,40 +166,149 @@ type StateMachine struct {
 
 // State contains state configuration.
 type State struct {
+	// ID identifies the state definition within its machine, numbering states
+	// from 1 in the order they were created.
+	ID          int
 	Source      []string
 	Destination string
+	// Meta holds arbitrary values attached with WithMeta.
+	Meta map[string]interface{}
 
 	// onEnterFunc is the function called when the state is entered.
-	onEnterFunc func(*State)
+	onEnterFunc func(*State) error
+	// fallible is set when onEnterFunc was set by OnEnterE.
+	fallible bool
+	// onExitFunc is the function called when the state is left.
+	onExitFunc func(*State)
+	// withCtx gives the state a context even without a machine context.
+	withCtx bool
+	// onEnterRef and onExitRef name registered handlers, see BindHandlers.
+	onEnterRef string
+	onExitRef  string
 
 	// parallel decides whnever the onEnterFunc should be called in a new goroutine.
 	parallel bool
-	fromAny  bool
-	ctx      context.Context
-	cancel   context.CancelFunc
+	// parallelFn decides the same at transition time when set.
+	parallelFn func(*State) bool
+	fromAny    bool
+	fromStart  bool
+	// except lists the sources FromAny does not apply to.
+	except []string
+	// sourcePatterns are the source patterns set by FromPattern.
+	sourcePatterns []string
+	// priority orders states entered by the same event.
+	priority int
+	// resolveFn picks the destination when the state is fired.
+	resolveFn func(from *State) (string, bool)
+	final     bool
+	roles     []string
+	// triggers are the events declared with On, internals the events handled
+	// without leaving the state.
+	triggers  []string
+	internals map[string]func(*State)
+	guards    []Guard
+	ctx       context.Context
+	cancel    context.CancelFunc
+	// data is the payload of the transition that entered the state.
+	data interface{}
+
+	// isPattern marks states defined by ToPattern, pattern is set on members.
+	isPattern bool
+	pattern   *State
+
+	// allowSelf makes transitions to the current state enter it again.
+	allowSelf bool
+
+	// parent is the destination of the enclosing state, set by Parent.
+	parent string
+
+	// retries is the number of times a failed OnEnterE is repeated, waiting
+	// backoff in between.
+	retries int
+	backoff time.Duration
+
+	// exclusive rejects entering the state while flags.busy is set.
+	exclusive bool
+
+	// timeout is the time after which the machine moves on to timeoutState.
+	timeout      time.Duration
+	timeoutState string
+
+	// throttle is the minimum interval between entries.
+	throttle     time.Duration
+	throttleMode ThrottleMode
+
+	// flags is set for exclusive and throttled states, and shared with the
+	// members of a pattern state.
+	flags *stateFlags
+
+	// machine is the state machine the state was created by.
+	machine *StateMachine
 }
 
 // Transition contains transition information.
 type Transition struct {
+	// ID numbers the transitions made by the machine, counting up from 1.
+	ID   uint64
 	From *State
 	To   *State
+	// Data is the payload passed to TransitionWith.
+	Data interface{}
+	// Time is when the transition was made.
+	Time time.Time
+
+	machine *StateMachine
+	// done is closed once a waited for transition has been executed.
+	done chan struct{}
+	// committed is closed once a fallible transition changed the current state.
+	committed chan struct{}
+	// err is the error returned by the enter function.
+	err error
 }
 
+// DefaultEnterMode decides how the default enter function relates to a states own OnEnter.
+type DefaultEnterMode int
+
+const (
+	// DefaultEnterInstead calls the default function only for states without an OnEnter.
+	DefaultEnterInstead DefaultEnterMode = iota
+	// DefaultEnterBefore calls the default function before every states own OnEnter.
+	DefaultEnterBefore
+)
+
 // To assigns a Destination to the State.
 func (st *State) To(dn string) *State {
 	st.Destination = dn
+	st.invalidate()
 	return st
 }
 
 // FromAny allows the state to be transitioned to from any other state.
 func (st *State) FromAny() *State {
 	st.fromAny = true
+	st.invalidate()
+	return st
+}
+
+// ExceptFrom forbids transitions to the state from the given sources, taking
+// precedence over FromAny.
+func (st *State) ExceptFrom(src ...string) *State {
+	st.except = append(st.except, src...)
+	st.invalidate()
+	return st
+}
+
+// FromStart allows the state to be transitioned to from the start state.
+func (st *State) FromStart() *State {
+	st.fromStart = true
+	st.invalidate()
 	return st
 }
 
 // From assigns a Source to the State.
 func (st *State) From(src ...string) *State {
 	st.Source = src
+	st.invalidate()
 	return st
 }
 
@@ -67,77 +317,470 @@ func (s *StateMachine) Transitions() <-chan *Transition {
 	return s.transitions
 }
 
+// Errors returns the channel receiving errors that can not be returned to a
+// caller, such as panics recovered from handlers, errors of parallel OnEnterE
+// functions and guard rejections of fired events. It buffers 16 errors, newer
+// errors are dropped while the buffer is full so the machine never blocks.
+func (s *StateMachine) Errors() <-chan error {
+	return s.errors
+}
+
+// emitError sends an error to the errors channel without blocking.
+func (s *StateMachine) emitError(err error) {
+	if err == nil {
+		return
+	}
+
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
 // BeforeTransition sets an action to be called before state transition is executed.
 func (s *StateMachine) BeforeTransition(f func(*Transition)) {
 	// Store the method.
 	s.beforeFn = f
 }
 
+// BeforeTransitionE sets a check to be called before state transition is
+// executed, in addition to the BeforeTransition action. An error vetoes the
+// transition: no exit or enter function is called and the machine reverts to
+// the state it came from. The error is returned to a caller waiting for the
+// transition, and sent to the Errors channel otherwise.
+func (s *StateMachine) BeforeTransitionE(f func(*Transition) error) {
+	s.beforeEFn = f
+}
+
 // AfterTransition sets an action to be called after state transition is executed.
 func (s *StateMachine) AfterTransition(f func(*Transition)) {
 	// Store the method.
 	s.afterFn = f
 }
 
+// OnStart sets the function to be called with the start state by Start.
+func (s *StateMachine) OnStart(f func(*State)) {
+	s.onStart = f
+}
+
+// OnComplete sets the function to be called with a final state once it has
+// been entered successfully.
+func (s *StateMachine) OnComplete(f func(*State)) {
+	s.completeFn = f
+}
+
+// DefaultOnEnter sets a function to be called when any state is entered.
+// By default it only runs for states without their own OnEnter, pass
+// DefaultEnterBefore to run it ahead of every states OnEnter instead.
+func (s *StateMachine) DefaultOnEnter(f func(*State), mode ...DefaultEnterMode) {
+	s.defaultEnterFn = f
+	s.defaultEnterMode = DefaultEnterInstead
+	if len(mode) > 0 {
+		s.defaultEnterMode = mode[0]
+	}
+}
+
+// SetTransitionFilter sets a machine wide gate applied to every transition.
+// The filter only runs once the target state exists and its source rules
+// permit the change, and before any state guards. A false result rejects the
+// transition with ErrFiltered.
+// The from name is empty when no state has been set yet.
+func (s *StateMachine) SetTransitionFilter(f func(from, to string) bool) {
+	s.filterFn = f
+}
+
 // OnEnter setups the function to be called when a state is entered.
 func (st *State) OnEnter(f func(s *State)) *State {
+	st.onEnterFunc = func(s *State) error {
+		f(s)
+		return nil
+	}
+	st.fallible = false
+	return st
+}
+
+// OnEnterCtx setups the function to be called with the state context when a
+// state is entered. The state always gets a context, which is cancelled when
+// the state is left, so parallel functions can stop early.
+func (st *State) OnEnterCtx(f func(ctx context.Context, s *State)) *State {
+	st.onEnterFunc = func(s *State) error {
+		f(s.ctx, s)
+		return nil
+	}
+	st.fallible = false
+	st.withCtx = true
+	return st
+}
+
+// OnEnterE setups a function to be called when a state is entered that can fail.
+// An error reverts the machine to the state it came from. Transitions to the
+// state wait for the function and return its error, so they must not be made
+// from a handler run by the executor. Errors are sent to the Errors channel as
+// well, which is the only place they are reported for parallel states unless
+// the transition is waited for.
+func (st *State) OnEnterE(f func(s *State) error) *State {
 	st.onEnterFunc = f
+	st.fallible = true
+	return st
+}
+
+// WithMeta attaches a value, such as a label or description, to the state.
+func (st *State) WithMeta(key string, val interface{}) *State {
+	if st.Meta == nil {
+		st.Meta = map[string]interface{}{}
+	}
+	st.Meta[key] = val
+	return st
+}
+
+// MetaValue returns the value attached to the state with WithMeta.
+func (st *State) MetaValue(key string) (interface{}, bool) {
+	val, ok := st.Meta[key]
+	return val, ok
+}
+
+// OnExit setups the function to be called when a state is left.
+func (st *State) OnExit(f func(s *State)) *State {
+	st.onExitFunc = f
+	return st
+}
+
+// OnExitCtx setups the function to be called with a context when a state is
+// left. As the state context is already cancelled by then, the machine context
+// is passed instead, or the background context when the machine has none.
+func (st *State) OnExitCtx(f func(ctx context.Context, s *State)) *State {
+	st.onExitFunc = func(s *State) {
+		ctx := context.Background()
+		if s.machine != nil && s.machine.ctx != nil {
+			ctx = s.machine.ctx
+		}
+		f(ctx, s)
+	}
 	return st
 }
 
 // Parallel sets how the onEnterFunc should be called.
 func (st *State) Parallel(p bool) *State {
 	st.parallel = p
+	st.parallelFn = nil
+	return st
+}
+
+// ParallelIf sets a function deciding at transition time whether the
+// onEnterFunc should be called in a new goroutine.
+func (st *State) ParallelIf(f func(*State) bool) *State {
+	st.parallelFn = f
+	return st
+}
+
+// runsParallel reports whether entering the state runs in a new goroutine.
+func (st *State) runsParallel() bool {
+	if st.parallelFn != nil {
+		return st.parallelFn(st)
+	}
+	return st.parallel
+}
+
+// AllowSelf makes transitions from the state to itself exit and enter it again,
+// instead of being ignored.
+func (st *State) AllowSelf() *State {
+	st.allowSelf = true
+	return st
+}
+
+// Final marks the state as a final state of the workflow.
+func (st *State) Final() *State {
+	st.final = true
 	return st
 }
 
-// Context returns the states context.
+// RequireRole restricts entering the state to callers of TransitionAs holding at
+// least one of the given roles. Plain Transition calls are always forbidden.
+func (st *State) RequireRole(roles ...string) *State {
+	st.roles = append(st.roles, roles...)
+	return st
+}
+
+// permitsRoles reports whether the roles satisfy the state requirement.
+func (st *State) permitsRoles(roles []string) bool {
+	if len(st.roles) == 0 {
+		return true
+	}
+
+	for _, required := range st.roles {
+		for _, role := range roles {
+			if role == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Exclusive prevents the state from being entered again while its onEnterFunc
+// is still running, such attempts are rejected with ErrStateBusy. This is mostly
+// useful for parallel states with long running handlers.
+func (st *State) Exclusive() *State {
+	st.exclusive = true
+	st.initFlags()
+	return st
+}
+
+// Context returns the states context, or nil when the machine has no context.
 func (st *State) Context() context.Context {
-	if st.ctx != nil {
-		return st.ctx
+	return st.ctx
+}
+
+// String describes the state for debugging, such as
+// "State(review, from=[draft], flags=final)". The start state entered by Start
+// is described as StartName.
+func (st *State) String() string {
+	if st == nil {
+		return "<nil>"
+	}
+	if st.machine != nil && st == st.machine.start {
+		return StartName
 	}
 
-	return context.Background()
+	flags := []string{}
+	if st.fromStart {
+		flags = append(flags, "start")
+	}
+	if st.fromAny {
+		flags = append(flags, "any")
+	}
+	if st.final {
+		flags = append(flags, "final")
+	}
+	if st.parallel || st.parallelFn != nil {
+		flags = append(flags, "parallel")
+	}
+
+	desc := fmt.Sprintf("State(%s, from=%v", st.Destination, st.Source)
+	if len(flags) > 0 {
+		desc += ", flags=" + strings.Join(flags, "|")
+	}
+	return desc + ")"
 }
 
-// do executes the transition by exiting the previous state, and entering the new one.
-func (t *Transition) do() {
+// String describes the transition as "from -> to". Transitions without a
+// source start from StartName.
+func (t *Transition) String() string {
+	from := StartName
+	if t.From != nil && (t.From.machine == nil || t.From != t.From.machine.start) {
+		from = t.From.Destination
+	}
+	return from + " -> " + t.To.Destination
+}
+
+// name returns the destination of a possibly nil state.
+func (st *State) name() string {
+	if st == nil {
+		return ""
+	}
+	return st.Destination
+}
+
+// stateFlags holds the fields of a state updated while the machine runs.
+type stateFlags struct {
+	// lastEntry is in nanoseconds.
+	lastEntry int64
+	busy      int32
+}
+
+// initFlags allocates the flags of the state while it is being defined.
+func (st *State) initFlags() {
+	if st.flags == nil {
+		st.flags = &stateFlags{}
+	}
+}
+
+// release clears the busy flag of an exclusive state.
+func (st *State) release() {
+	if st.exclusive {
+		atomic.StoreInt32(&st.flags.busy, 0)
+	}
+}
+
+// Do executes the transition by exiting the previous state, and entering the new one.
+// It is called by Initialize, or by consumers reading the Transitions channel.
+func (t *Transition) Do() {
+	if t.machine != nil {
+		t.machine.wait(t)
+	}
+
+	from, to := t.names()
+	t.machine.log().Debugf("Exiting state: %v (#%d)", from, t.ID)
+	t.err = recovered(t.exit)
+	started := time.Now()
+	if t.err == nil {
+		t.machine.log().Debugf("Entering state: %v (#%d)", to, t.ID)
+		t.err = recovered(t.enter)
+	}
+	t.To.release()
+
+	if t.err != nil && t.machine != nil {
+		t.machine.log().Infof("Transition failed: %v > %v (#%d): %v", from, to, t.ID, t.err)
+		if t.committed != nil {
+			<-t.committed
+			t.machine.revert(t)
+		}
+		t.machine.emitError(t.err)
+	}
+
+	if t.machine != nil {
+		t.machine.handlerTimed(t.To.Destination, time.Since(started))
+		t.machine.notify(t)
+		if t.err == nil && t.To.final && t.machine.completeFn != nil {
+			t.machine.completeFn(t.To)
+		}
+	}
+
+	if t.done != nil {
+		close(t.done)
+	}
+}
+
+// exit calls the exit function of the state left and the OnExitState functions
+// for it, then the exit functions of the parents left.
+func (t *Transition) exit() error {
+	if t.From != nil && t.From.onExitFunc != nil {
+		t.From.onExitFunc(t.From)
+	}
+	if t.From != nil && t.machine != nil {
+		t.machine.runHooks(t.machine.exitHooks, t.From)
+	}
+	for _, parent := range t.exitedParents() {
+		if parent.onExitFunc != nil {
+			parent.onExitFunc(parent)
+		}
+	}
+	return nil
+}
+
+// enter calls the enter functions of the parents entered, then the default and
+// own enter functions of the inbound state, and the OnEnterState functions for
+// it once those succeeded.
+func (t *Transition) enter() error {
+	for _, parent := range t.enteredParents() {
+		if parent.onEnterFunc != nil {
+			if err := parent.onEnterFunc(parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	if t.machine != nil && t.machine.defaultEnterFn != nil {
+		if t.To.onEnterFunc == nil || t.machine.defaultEnterMode == DefaultEnterBefore {
+			t.machine.defaultEnterFn(t.To)
+		}
+	}
+
 	if t.To.onEnterFunc != nil {
-		t.To.onEnterFunc(t.To)
+		if err := t.To.retried(t.To.onEnterFunc); err != nil {
+			return err
+		}
+	}
+	if t.machine != nil {
+		t.machine.runHooks(t.machine.enterHooks, t.To)
 	}
+	return nil
+}
+
+// recovered calls f, turning a panic into an error.
+func recovered(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return f()
 }
 
 func (s *StateMachine) before(t *Transition) {
 	if s.beforeFn != nil {
-		s.beforeFn(t)
+		s.emitError(recovered(func() error {
+			s.beforeFn(t)
+			return nil
+		}))
 	}
 }
 
 func (s *StateMachine) after(t *Transition) {
 	if s.afterFn != nil {
-		s.afterFn(t)
+		s.emitError(recovered(func() error {
+			s.afterFn(t)
+			return nil
+		}))
 	}
 }
 
 // Find locates a state by name.
+// Exact definitions take precedence over pattern states. Names defined more
+// than once return their first definition, transitions use the definition
+// permitting the current state instead.
 func (s *StateMachine) Find(st string) (state *State, err error) {
-	for _, state := range s.States {
-		if state.Destination == st {
-			return state, nil
+	if defs := s.findDefinitions(st); len(defs) > 0 {
+		return defs[0], nil
+	}
+
+	if state := s.findPattern(st); state != nil {
+		return state, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrInvalidState, st)
+}
+
+// findDefinitions returns the states defined with the name in definition
+// order.
+func (s *StateMachine) findDefinitions(st string) []*State {
+	if idx := s.lookupIndex(); idx != nil {
+		return idx.find(st)
+	}
+
+	var found []*State
+	for _, state := range s.definitions() {
+		if s.equal(state.Destination, st) {
+			found = append(found, state)
 		}
 	}
+	return found
+}
+
+// findPermitted returns the definition of name permitting the change from the
+// given state, or the first definition when none does. More than one
+// permitting definition makes the change ambiguous.
+func (s *StateMachine) findPermitted(from *State, name string) (*State, error) {
+	defs := s.findDefinitions(name)
+	if len(defs) < 2 {
+		return s.Find(name)
+	}
 
-	return nil, fmt.Errorf("Invalid state: %v", st)
+	var found *State
+	for _, st := range defs {
+		if !s.permitsSource(from, st) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%w: %v > %v", ErrAmbiguousState, from.name(), name)
+		}
+		found = st
+	}
+	if found == nil {
+		found = defs[0]
+	}
+	return found, nil
 }
 
 // Match returns true when the input matches the current state Destination.
 func (s *StateMachine) Match(compare ...string) bool {
-	if !s.Exists() {
+	current := s.current()
+	if current == nil {
 		return false
 	}
 
 	for _, state := range compare {
-		match := s.CurrentState.Destination == state
+		match := s.equal(current.Destination, state)
 		if match {
 			return true
 		}
@@ -145,18 +788,208 @@ func (s *StateMachine) Match(compare ...string) bool {
 	return false
 }
 
+// IsFinished returns true when the current state is a final state.
+func (s *StateMachine) IsFinished() bool {
+	current := s.current()
+	return current != nil && current.final
+}
+
+// IsTerminal returns true when the current state is a final state. It is the
+// same as IsFinished.
+func (s *StateMachine) IsTerminal() bool {
+	return s.IsFinished()
+}
+
 // Exists determines whether a state has been set.
 func (s *StateMachine) Exists() bool {
-	return s.CurrentState != nil
+	return s.current() != nil
+}
+
+// current returns the current state.
+func (s *StateMachine) current() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.CurrentState
+}
+
+// setCurrent makes st the current state, remembering the state left.
+func (s *StateMachine) setCurrent(st *State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previous = s.CurrentState
+	s.CurrentState = st
+}
+
+// Start launches the state machine, enters the start state and calls the
+// OnStart function with it. Only states using FromStart or FromAny can be
+// transitioned to from the start state.
+func (s *StateMachine) Start() error {
+	st, err := s.enterStart()
+	if err != nil {
+		return err
+	}
+
+	s.onStart(st)
+	return nil
+}
+
+// Reset returns a started machine to a new start state and calls the OnStart
+// function with it again. The current state context is cancelled, the state
+// definitions are kept.
+func (s *StateMachine) Reset() error {
+	st, err := s.enterStart()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.previous = nil
+	s.mu.Unlock()
+	s.onStart(st)
+	return nil
+}
+
+// StartIn launches the state machine directly in the named state, such as when
+// resuming a workflow. The state gets a context and its enter functions are
+// called on the calling goroutine, then the OnStart function is called with it
+// when set. The error of a failing enter function is returned, the machine
+// stays in the state.
+func (s *StateMachine) StartIn(name string) error {
+	s.Initialize()
+
+	st, err := s.Find(name)
+	if err != nil {
+		return err
+	}
+
+	s.transitionMu.Lock()
+	current := s.current()
+	if current != nil && current.cancel != nil {
+		current.cancel()
+	}
+	if s.ctx != nil {
+		st.ctx, st.cancel = context.WithCancel(s.ctx)
+	}
+	s.entered(current)
+	s.setInitial(st.Destination)
+	s.setCurrent(st)
+	s.transitionMu.Unlock()
+	atomic.StoreInt32(&s.started, 1)
+	s.emit(Event{Kind: Started, State: st.Destination})
+
+	tr := &Transition{
+		ID:      atomic.AddUint64(&s.transitionIDs, 1),
+		To:      st,
+		Time:    time.Now(),
+		machine: s,
+		done:    make(chan struct{}),
+	}
+	tr.Do()
+	if tr.err != nil {
+		return tr.err
+	}
+
+	if s.onStart != nil {
+		s.onStart(st)
+	}
+	return nil
 }
 
-// Start launches the state machine
-func (s *StateMachine) Start() {
+// StartAsync works like Start but calls the OnStart function in a new goroutine.
+// The returned channel receives nil once it completes, or the machine context
+// error when the machine is cancelled first.
+func (s *StateMachine) StartAsync() <-chan error {
+	result := make(chan error, 1)
+
+	st, err := s.enterStart()
+	if err != nil {
+		result <- err
+		return result
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.onStart(st)
+		close(done)
+	}()
+
+	var cancelled <-chan struct{}
+	if s.ctx != nil {
+		cancelled = s.ctx.Done()
+	}
+
+	go func() {
+		select {
+		case <-done:
+			result <- nil
+		case <-cancelled:
+			result <- s.ctx.Err()
+		}
+	}()
+
+	return result
+}
+
+// enterStart launches the machine and sets the start state as current.
+func (s *StateMachine) enterStart() (*State, error) {
+	s.Initialize()
+
+	if s.onStart == nil {
+		return nil, ErrMissingOnStart
+	}
+
+	st := &State{machine: s}
+	if s.ctx != nil {
+		st.ctx, st.cancel = context.WithCancel(s.ctx)
+	}
+
+	current := s.current()
+	if current != nil && current.cancel != nil {
+		current.cancel()
+	}
+	s.entered(current)
+	s.start = st
+	s.setInitial(StartName)
+	s.setCurrent(st)
+	atomic.StoreInt32(&s.started, 1)
+	s.emit(Event{Kind: Started})
+	return st, nil
+}
+
+// InitialStateName returns the name of the state the machine began in. It is
+// StartName after Start, the named state after StartIn, or the first state
+// transitioned to when the machine was never started, and empty before either
+// happened.
+func (s *StateMachine) InitialStateName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initial
+}
+
+// setInitial records name as the state the machine began in.
+func (s *StateMachine) setInitial(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initial = name
+}
+
+// Started returns true once Start, StartAsync or StartIn has entered the start
+// state.
+func (s *StateMachine) Started() bool {
+	return atomic.LoadInt32(&s.started) == 1
+}
+
+// Initialize launches the goroutine executing queued transitions. Machines
+// without a context get the background context, so Stop ends the goroutine.
+func (s *StateMachine) Initialize() {
 	if s.initialized {
 		return
 	}
 
 	s.initialized = true
+	if s.ctx == nil {
+		s.WithContext(context.Background())
+	}
 
 	go func() {
 		for {
@@ -168,108 +1001,669 @@ func (s *StateMachine) Start() {
 					return
 				}
 
-				s.before(t)
-				t.do()
-				s.after(t)
+				// A panic must not stop the executor, which would block
+				// every later transition.
+				s.emitError(recovered(func() error {
+					s.execute(t)
+					return nil
+				}))
 			}
 		}
 	}()
 }
 
+// ProcessNext executes a single queued transition on the calling goroutine and
+// reports whether one was waiting. It gives tests a way to step through the machine
+// without Initialize, the two should not be used together.
+func (s *StateMachine) ProcessNext() (bool, error) {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return false, s.ctx.Err()
+	}
+
+	select {
+	case t := <-s.transitions:
+		s.execute(t)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// execute runs a transition along with the before and after actions, unless
+// it is vetoed.
+func (s *StateMachine) execute(t *Transition) {
+	s.before(t)
+	if s.beforeEFn != nil {
+		if err := recovered(func() error { return s.beforeEFn(t) }); err != nil {
+			s.veto(t, err)
+			return
+		}
+	}
+	t.Do()
+	s.after(t)
+}
+
+// veto reverts a transition which was not executed.
+func (s *StateMachine) veto(t *Transition, err error) {
+	from, to := t.names()
+	s.log().Infof("Transition vetoed: %v > %v (#%d): %v", from, to, t.ID, err)
+
+	t.err = err
+	t.To.release()
+	<-t.committed
+	s.revert(t)
+	if t.done == nil {
+		s.emitError(err)
+	} else {
+		close(t.done)
+	}
+}
+
+// PreviousState returns the state left by the last committed transition, or
+// nil before the first one.
+func (s *StateMachine) PreviousState() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.previous
+}
+
+// PreviousName returns the previous States destination name.
+func (s *StateMachine) PreviousName() string {
+	return s.PreviousState().name()
+}
+
 // Name returns the current States destination name.
 func (s *StateMachine) Name() string {
-	if s.Exists() {
-		return s.CurrentState.Destination
-	}
-	return ""
+	return s.current().name()
 }
 
 // IsValidStateChange returns an error when the state change is not permitted.
+// Of names defined more than once, the definition permitting the current state
+// is used.
 func (s *StateMachine) IsValidStateChange(name string) (*State, error) {
+	return s.validStateChange(s.current(), name)
+}
+
+// validStateChange returns an error when the change from the given state to
+// name is not permitted.
+func (s *StateMachine) validStateChange(from *State, name string) (*State, error) {
 	// Find next state
-	st, err := s.Find(name)
+	st, err := s.findPermitted(from, name)
+	if err != nil && !errors.Is(err, ErrAmbiguousState) && s.unknownFn != nil {
+		st, err = s.resolveUnknown(name, err)
+	}
 	if err != nil {
 		return st, err
 	}
+	return s.isValidChange(from, st)
+}
+
+// isValidChange returns an error when the change from the given state to st is
+// not permitted.
+func (s *StateMachine) isValidChange(from, st *State) (*State, error) {
+	if !s.permitsSource(from, st) {
+		return st, fmt.Errorf("%w: %v > %v", ErrInvalidStateChange, from.name(), st.Destination)
+	}
+
+	// The machine wide filter applies on top of the state rules.
+	if s.filterFn != nil && !s.filterFn(from.name(), st.Destination) {
+		return st, fmt.Errorf("%w: %v > %v", ErrFiltered, from.name(), st.Destination)
+	}
+
+	// State guards run last as they are the most specific.
+	if err := s.checkGuards(from, st); err != nil {
+		return st, err
+	}
+
+	return st, nil
+}
+
+// OnUnknownState sets a function consulted when transitioning to a state that
+// is not defined. It can define the state, usually through NewState, or return
+// an error rejecting the transition. States it returns that were not created by
+// NewState are added to the machine. Find, ForEachState and the exports are
+// safe to use while states are added this way.
+func (s *StateMachine) OnUnknownState(f func(name string) (*State, error)) {
+	s.unknownFn = f
+}
+
+// resolveUnknown consults the unknown state function.
+func (s *StateMachine) resolveUnknown(name string, notFound error) (*State, error) {
+	st, err := s.unknownFn(name)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, notFound
+	}
+
+	if st.machine != s {
+		st.machine = s
+		s.defMu.Lock()
+		s.States = append(s.States, st)
+		s.index = nil
+		s.defMu.Unlock()
+	}
+	return st, nil
+}
+
+// permitsSource checks the source rules of st for a change from the given state.
+func (s *StateMachine) permitsSource(from, st *State) bool {
+	// Excluded sources are rejected even for FromAny states.
+	if from != nil {
+		for _, src := range st.except {
+			if s.equal(src, from.Destination) {
+				return false
+			}
+		}
+	}
 
 	// This state accepts transitions from any other state.
 	if st.fromAny {
-		return st, nil
+		return true
 	}
 
 	// There is no existing origin state so any entrypoint is allowed.
-	if s.CurrentState == nil {
-		return st, nil
+	if from == nil {
+		return true
 	}
 
-	for _, source := range st.Source {
-		if source == s.CurrentState.Destination {
-			return st, nil
+	if st.allowSelf && from.definition() == st.definition() && s.equal(from.Destination, st.Destination) {
+		return true
+	}
+
+	// Leaving the start state requires an explicit FromStart.
+	if from == s.start {
+		return st.fromStart
+	}
+
+	if idx := s.lookupIndex(); idx != nil {
+		if idx.permits(from.Destination, st) ||
+			(from.pattern != nil && idx.permits(from.pattern.Destination, st)) {
+			return true
+		}
+	} else {
+		for _, source := range st.Source {
+			if s.equal(source, from.Destination) {
+				return true
+			}
+			// Members of a pattern family can be left through the pattern name.
+			if from.pattern != nil && s.equal(source, from.pattern.Destination) {
+				return true
+			}
 		}
 	}
 
-	return st, fmt.Errorf("Invalid state change: %v > %v", s.CurrentState.Destination, st.Destination)
+	return st.matchesSourcePattern(from.Destination)
+}
+
+// transitionRequest holds the caller supplied details of a transition.
+type transitionRequest struct {
+	to    string
+	roles []string
+	// ctx provides values for the inbound state context, and cancels it too
+	// when linked is set.
+	ctx    context.Context
+	linked bool
+	data   interface{}
+	// waiter is set when the caller waits for the transition to execute.
+	waiter *waiter
+	// from is the state the machine must still be in when expectFrom is set.
+	from       *State
+	expectFrom bool
+	// state is the definition to enter, when the caller already picked one.
+	state *State
+}
+
+// plain returns true for requests made by Transition, which carry nothing but
+// the target.
+func (req transitionRequest) plain() bool {
+	return len(req.roles) == 0 && req.ctx == nil && req.data == nil &&
+		req.waiter == nil && req.state == nil && !req.expectFrom
 }
 
 // Transition changes the state when permissible.
-func (s *StateMachine) Transition(to string) (err error) {
-	// Ignore transitions to the same state.
-	if s.Match(to) {
+func (s *StateMachine) Transition(to string) error {
+	return s.TransitionWith(to, nil)
+}
+
+// TransitionAs changes the state when permissible and the roles satisfy the
+// requirements of the inbound state, otherwise ErrForbidden is returned.
+func (s *StateMachine) TransitionAs(roles []string, to string) error {
+	return s.transition(transitionRequest{to: to, roles: roles})
+}
+
+// ProposeTransition validates a transition without performing it, returning
+// the prepared transition and a function committing it. The commit function
+// returns ErrStateChanged when the current state is no longer the one the
+// proposal was made from.
+func (s *StateMachine) ProposeTransition(to string) (*Transition, func() error, error) {
+	state, err := s.IsValidStateChange(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tr := &Transition{
+		From:    s.current(),
+		To:      state,
+		machine: s,
+	}
+
+	commit := func() error {
+		return s.transition(transitionRequest{to: to, from: tr.From, expectFrom: true})
+	}
+
+	return tr, commit, nil
+}
+
+// stateParent returns the context the inbound state context derives from.
+func (s *StateMachine) stateParent(req transitionRequest) context.Context {
+	parent := s.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	if req.ctx != nil {
+		return valueContext{Context: parent, vals: req.ctx}
+	}
+	return parent
+}
+
+func (s *StateMachine) transition(req transitionRequest) error {
+	coalesce := s.coalescer != nil && req.plain()
+	if req.waiter == nil {
+		req.waiter = &waiter{lazy: !s.blocking}
+	}
+
+	next := func(to string) error {
+		req.to = to
+		// Coalesced calls share the outcome of executing the transition too.
+		if coalesce {
+			return s.coalescer.do(req.to, func() error {
+				if err := s.attempt(req); err != nil {
+					return err
+				}
+				return s.awaitExecuted(req.waiter)
+			})
+		}
+		return s.attempt(req)
+	}
+
+	if len(s.middleware) > 0 {
+		next = s.wrap(next)
+	}
+
+	if err := next(req.to); err != nil {
+		return err
+	}
+	return s.awaitExecuted(req.waiter)
+}
+
+// revert returns to the state t came from after its enter function failed,
+// unless the machine has moved on since.
+func (s *StateMachine) revert(t *Transition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.CurrentState != t.To {
+		return
+	}
+
+	if t.To.cancel != nil {
+		t.To.cancel()
+	}
+	if t.From != nil && s.ctx != nil {
+		t.From.ctx, t.From.cancel = context.WithCancel(s.ctx)
+	}
+	s.previous = t.To
+	s.CurrentState = t.From
+}
+
+// attempt applies a transition, reporting rejections as events.
+// Transitions are applied one at a time, the events and invariant checks of a
+// committed transition run outside of that.
+func (s *StateMachine) attempt(req transitionRequest) error {
+	s.log().Debugf("Transition requested: %v > %v", s.Name(), req.to)
+
+	var from string
+	var tr *Transition
+	var err error
+	for {
+		s.transitionMu.Lock()
+		from = s.Name()
+		tr, err = s.apply(req)
+		s.transitionMu.Unlock()
+
+		// Delayed states are waited for unlocked, then the transition is
+		// applied again as the machine may have moved on.
+		var delay *throttleDelay
+		if !errors.As(err, &delay) {
+			break
+		}
+		if err = s.waitThrottle(delay.st); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		s.log().Infof("Transition rejected: %v > %v: %v", from, req.to, err)
+		s.emit(Event{Kind: Rejected, State: from, To: req.to, Err: err})
+		return err
+	}
+	if tr != nil {
+		s.log().Debugf("Transition committed: %v > %v (#%d)", from, tr.To.Destination, tr.ID)
+		s.committed(tr)
+	}
+	return nil
+}
+
+// committed reports a committed transition and checks the invariants.
+func (s *StateMachine) committed(tr *Transition) {
+	s.notifyObservers(tr, true)
+	s.emit(Event{Kind: Transitioned, State: tr.To.Destination, Transition: tr})
+	if tr.To.final {
+		s.emit(Event{Kind: Finished, State: tr.To.Destination, Transition: tr})
+	}
+	s.checkInvariants()
+}
+
+// apply validates and commits a transition, then dispatches it for execution.
+func (s *StateMachine) apply(req transitionRequest) (tr *Transition, err error) {
+	if s.Stopped() {
+		return nil, fmt.Errorf("%w: %v", ErrStopped, req.to)
+	}
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrContextDone, req.to)
+	}
+
+	// Proposed transitions only commit from the state they were proposed in.
+	current := s.current()
+	if req.expectFrom && current != req.from {
+		return nil, fmt.Errorf("%w: %v > %v", ErrStateChanged, req.from.name(), current.name())
+	}
+
+	// Ignore transitions to the same state, unless it allows them.
+	if s.Match(req.to) && !current.allowSelf {
 		return
 	}
 
 	// Check if new state is valid.
-	state, err := s.IsValidStateChange(to)
+	var state *State
+	if req.state != nil && s.equal(req.state.Destination, req.to) {
+		state, err = s.isValidChange(current, req.state)
+	} else {
+		state, err = s.validStateChange(current, req.to)
+	}
 
 	if err != nil {
 		return
 	}
 
+	if !state.permitsRoles(req.roles) {
+		return nil, fmt.Errorf("%w: %v > %v", ErrForbidden, s.Name(), state.Destination)
+	}
+
+	if err = s.checkGroups(state); err != nil {
+		return
+	}
+
+	if err = s.checkThrottle(state); err != nil {
+		return
+	}
+
+	// Exclusive states are held until their handler returns.
+	if state.exclusive && !atomic.CompareAndSwapInt32(&state.flags.busy, 0, 1) {
+		return nil, fmt.Errorf("%w: %v", ErrStateBusy, state.Destination)
+	}
+
+	// Self transitions replace the context of the current state.
+	var leave context.CancelFunc
+	if current != nil {
+		leave = current.cancel
+	}
+
 	// Give the inbound state a new context.
-	if s.ctx != nil {
-		state.ctx, state.cancel = context.WithCancel(s.ctx)
+	if s.ctx != nil || req.ctx != nil || state.timeout > 0 || state.withCtx {
+		state.ctx, state.cancel = context.WithCancel(s.stateParent(req))
+		if req.linked {
+			linkCancel(req.ctx, state.ctx, state.cancel)
+		}
 	}
 
 	// Send transition to channel
-	tr := &Transition{
-		From: s.CurrentState,
-		To:   state,
+	state.data = req.data
+	tr = &Transition{
+		ID:      atomic.AddUint64(&s.transitionIDs, 1),
+		From:    current,
+		To:      state,
+		Data:    req.data,
+		Time:    time.Now(),
+		machine: s,
 	}
-
-	// Cancel current state context.
-	if s.CurrentState != nil && s.CurrentState.cancel != nil {
-		s.CurrentState.cancel()
+	parallel := state.runsParallel()
+	// Transitions which may be reverted wait until committed.
+	if state.fallible || s.beforeEFn != nil {
+		tr.committed = make(chan struct{})
+		defer close(tr.committed)
+	}
+	if req.waiter != nil && (!req.waiter.lazy || state.fallible && !parallel) {
+		tr.done = make(chan struct{})
+		req.waiter.tr = tr
 	}
 
-	if state.parallel {
-		go tr.do()
+	// Parallel states bypass the executor, so the before and after actions
+	// run in the goroutine too.
+	if parallel {
+		go s.execute(tr)
 	} else {
+		// The context may be done while throttling, the state is not
+		// entered then.
 		if s.ctx != nil && s.ctx.Err() != nil {
-			return
+			state.release()
+			if state.cancel != nil {
+				state.cancel()
+			}
+			return nil, fmt.Errorf("%w: %v", ErrContextDone, state.Destination)
+		}
+		if err := s.enqueue(tr); err != nil {
+			state.release()
+			if state.cancel != nil {
+				state.cancel()
+			}
+			return nil, err
+		}
+	}
+
+	state.throttleEntered()
+
+	// Cancel current state context.
+	if leave != nil {
+		leave()
+	}
+	if current == nil && s.InitialStateName() == "" {
+		s.setInitial(state.Destination)
+	}
+	s.entered(current)
+	s.counted(current, state)
+	s.setCurrent(state)
+	s.record(tr)
+	s.startTimeout(state)
+	return tr, nil
+}
+
+// Invariant adds a check that runs after every committed transition. Violations
+// are sent to the Errors channel, and when InvariantState is configured the
+// machine transitions to that state.
+func (s *StateMachine) Invariant(f func(*StateMachine) error) {
+	s.invariants = append(s.invariants, f)
+}
+
+// InvariantState sets the state to transition to when an invariant is violated.
+func (s *StateMachine) InvariantState(name string) {
+	s.invariantState = name
+}
+
+// checkInvariants runs the invariants against the current state.
+func (s *StateMachine) checkInvariants() {
+	for _, f := range s.invariants {
+		err := f(s)
+		if err == nil {
+			continue
 		}
-		s.transitions <- tr
+
+		s.emitError(fmt.Errorf("Invariant violated in %v: %w", s.Name(), err))
+		if s.invariantState != "" {
+			if err := s.Transition(s.invariantState); err != nil {
+				s.emitError(err)
+			}
+		}
+		return
 	}
-	s.CurrentState = state
-	return
 }
 
 // NewState returns a new state instance.
 func (s *StateMachine) NewState() *State {
-	st := &State{}
+	s.stateIDs++
+	st := &State{ID: s.stateIDs, machine: s}
+	s.defMu.Lock()
 	s.States = append(s.States, st)
+	s.index = nil
+	s.defMu.Unlock()
 
 	return st
 }
 
+// Sequence defines a linear workflow, entering the first state from the start
+// state and each further state from the one before it. Branches to or from a
+// state of the sequence are regular new states, defining a name of the
+// sequence again with other sources.
+func (s *StateMachine) Sequence(names ...string) *StateMachine {
+	for i, name := range names {
+		st := s.NewState().To(name)
+		if i == 0 {
+			st.FromStart()
+		} else {
+			st.From(names[i-1])
+		}
+	}
+	return s
+}
+
+// WithStateComparator sets how state names are compared by Find, Match and
+// IsValidStateChange, which default to exact equality. A comparator disables
+// the lookup table created by Build.
+func (s *StateMachine) WithStateComparator(f func(a, b string) bool) *StateMachine {
+	s.compareFn = f
+	return s
+}
+
+// CaseInsensitive makes Find, Match and Transition compare state names ignoring
+// case, or restores exact comparison. States keep the names they are defined
+// with. It replaces a comparator set by WithStateComparator.
+func (s *StateMachine) CaseInsensitive(b bool) *StateMachine {
+	if b {
+		return s.WithStateComparator(strings.EqualFold)
+	}
+	return s.WithStateComparator(nil)
+}
+
+// equal compares two state names.
+func (s *StateMachine) equal(a, b string) bool {
+	if s.compareFn != nil {
+		return s.compareFn(a, b)
+	}
+	return a == b
+}
+
+// Stop cancels the machine context along with the context of every state, so
+// handlers still running for earlier states observe the cancellation too.
+// Queued transitions are discarded, callers waiting for them and later
+// transitions get ErrStopped.
+// Calling Stop again has no effect.
+func (s *StateMachine) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.stopped, 0, 1) {
+		return
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.log().Infof("State machine stopped: %v", s.Name())
+	s.emit(Event{Kind: Stopped, State: s.Name()})
+	s.closeSubscribers()
+
+	if s.start != nil && s.start.cancel != nil {
+		s.start.cancel()
+	}
+	if current := s.current(); current != nil && current.cancel != nil {
+		current.cancel()
+	}
+	for _, st := range s.definitions() {
+		if st.cancel != nil {
+			st.cancel()
+		}
+	}
+
+	// The time spent in the current state ends here.
+	s.entered(s.current())
+
+	// The channel is drained rather than closed, so concurrent senders do
+	// not panic.
+	for {
+		select {
+		case t := <-s.transitions:
+			t.To.release()
+			// Callers waiting for the transition are released too.
+			t.err = ErrStopped
+			if t.done != nil {
+				close(t.done)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Stopped returns true once Stop has been called.
+func (s *StateMachine) Stopped() bool {
+	return atomic.LoadInt32(&s.stopped) == 1
+}
+
 // WithContext applies a context to the state machine.
 func (s *StateMachine) WithContext(ctx context.Context) *StateMachine {
 	s.ctx, s.cancel = context.WithCancel(ctx)
 	return s
 }
 
-// New returns a new, empty StateMachine instance
-func New() *StateMachine {
-	return &StateMachine{
-		transitions: make(chan *Transition, 1),
+// New returns a new, empty StateMachine instance configured by opts.
+func New(opts ...Option) *StateMachine {
+	s := &StateMachine{
+		transitions: newTransitions(1),
+		errors:      make(chan error, errorsBuffer),
+		events:      make(chan Event, eventsBuffer),
+		pauser:      newPauser(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewWithBuffer returns a new, empty StateMachine queueing up to size
+// transitions for the executor. Larger buffers let bursts of transitions return
+// without waiting for a slow executor, at the cost of the current state running
+// further ahead of the entered one. A size of 0 uses the default of 1, pass
+// Unbuffered to make every transition wait until the executor receives it.
+func NewWithBuffer(size int) *StateMachine {
+	return New(WithBuffer(size))
+}
+
+// newTransitions returns a transitions channel buffering size transitions, see
+// NewWithBuffer.
+func newTransitions(size int) chan *Transition {
+	switch {
+	case size == Unbuffered:
+		size = 0
+	case size < 1:
+		size = 1
 	}
+	return make(chan *Transition, size)
 }
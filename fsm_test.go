@@ -2,7 +2,13 @@ package fsm
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,6 +27,18 @@ func TestTo(t *testing.T) {
 	assert.Equal(st.Destination, "bar", "should set state to value")
 }
 
+func TestWithMeta(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	st := sm.NewState().To("bar").WithMeta("color", "red")
+
+	val, ok := st.MetaValue("color")
+	assert.True(ok, "should find attached values")
+	assert.Equal("red", val, "should return attached values")
+	_, ok = st.MetaValue("label")
+	assert.False(ok, "should not find missing values")
+}
+
 func TestName(t *testing.T) {
 	assert := assert.New(t)
 	sm := New()
@@ -112,6 +130,209 @@ func TestParallelState(t *testing.T) {
 	assert.True(called, "should call on enter function")
 }
 
+func TestParallelIfState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	done := make(chan bool)
+	parallel := false
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar").ParallelIf(func(*State) bool {
+		return parallel
+	}).OnEnter(func(*State) {
+		done <- true
+	})
+
+	sm.Transition("bar")
+	assert.Equal(1, sm.QueueDepth(), "should queue the transition when condition is false")
+	<-sm.Transitions()
+
+	parallel = true
+	sm.Transition("foo")
+	sm.Transition("bar")
+	assert.True(<-done, "should call on enter function in a new goroutine when condition is true")
+}
+
+func TestOnEnterE(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	failed := errors.New("write failed")
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	foo := sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").OnEnterE(func(*State) error {
+		return failed
+	})
+	sm.NewState().From("foo").To("baz").OnEnterE(func(*State) error {
+		return nil
+	})
+
+	sm.Transition("foo")
+	err := sm.Transition("bar")
+
+	assert.Equal(failed, err, "should return the enter function error")
+	assert.Equal(foo, sm.CurrentState, "should revert to the previous state")
+	assert.Nil(sm.Transition("baz"), "should not return an error when the enter function succeeds")
+	assert.Equal("baz", sm.Name(), "should change state")
+}
+
+func TestOnEnterEParallel(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	failed := errors.New("write failed")
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Parallel(true).OnEnterE(func(*State) error {
+		return failed
+	})
+
+	sm.Transition("foo")
+	(<-sm.Transitions()).Do()
+	err := sm.Transition("bar")
+
+	assert.Nil(err, "should not wait for parallel states")
+	assert.Equal(failed, <-sm.Errors(), "should send the error to the errors channel")
+	assert.Eventually(func() bool {
+		return sm.Name() == "foo"
+	}, time.Second, time.Millisecond, "should revert to the previous state")
+}
+
+func TestHandlerPanic(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	entered := make(chan bool, 1)
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(*State) {
+		panic("boom")
+	})
+	sm.NewState().FromAny().To("bar").OnEnter(func(*State) {
+		entered <- true
+	})
+	sm.BeforeTransition(func(t *Transition) {
+		if t.To.Destination == "bar" {
+			panic("before")
+		}
+	})
+	sm.Initialize()
+
+	sm.Transition("foo")
+	err := <-sm.Errors()
+	assert.True(errors.Is(err, ErrPanic), "should send recovered panics to the errors channel")
+	assert.EqualError(err, "Handler panicked: boom", "should include the panic value")
+
+	sm.Transition("bar")
+	assert.EqualError(<-sm.Errors(), "Handler panicked: before", "should recover panics of the before action")
+	assert.True(<-entered, "should keep executing transitions")
+}
+
+func TestOnExit(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := make(chan string, 2)
+
+	sm.NewState().From("bar").To("foo").OnExit(func(st *State) {
+		calls <- "exit " + st.Destination
+	})
+	sm.NewState().From("foo").To("bar").Parallel(true).OnEnter(func(st *State) {
+		calls <- "enter " + st.Destination
+	})
+
+	sm.Transition("foo")
+	(<-sm.Transitions()).Do()
+	sm.Transition("bar")
+
+	assert.Equal("exit foo", <-calls, "should call the exit function of the state left first")
+	assert.Equal("enter bar", <-calls, "should call the enter function after the exit function")
+}
+
+func TestPreviousState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	foo := sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+
+	sm.Transition("foo")
+	assert.Nil(sm.PreviousState(), "should have no previous state before the first change")
+
+	sm.Transition("bar")
+	sm.Transition("bar")
+	assert.Equal(foo, sm.PreviousState(), "should return the state left")
+	assert.Equal("foo", sm.PreviousName(), "should ignore same state transitions")
+}
+
+func TestConcurrentTransitions(t *testing.T) {
+	assert := assert.New(t)
+	history := NewMemoryHistory(1)
+	sm := New().WithHistoryStore(history)
+	names := []string{"foo", "bar", "baz"}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	for _, name := range names {
+		sm.NewState().FromAny().To(name)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			sm.Transition(name)
+			sm.Name()
+			sm.Match(name)
+		}(names[i%len(names)])
+	}
+	wg.Wait()
+
+	last, _ := history.All()
+	assert.Equal(last[0].To, sm.CurrentState, "should end in the state of the last committed transition")
+	assert.Equal(last[0].From, sm.PreviousState(), "should track the state left by the last committed transition")
+}
+
+func TestAllowSelf(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	calls := []string{}
+
+	st := sm.NewState().FromAny().To("processing").AllowSelf().OnEnter(func(*State) {
+		calls = append(calls, "enter")
+	}).OnExit(func(*State) {
+		calls = append(calls, "exit")
+	})
+
+	sm.Transition("processing")
+	(<-sm.Transitions()).Do()
+	first := st.Context()
+
+	err := sm.Transition("processing")
+	assert.Nil(err, "should not return an error")
+	assert.Equal(1, sm.QueueDepth(), "should not ignore the self transition")
+	(<-sm.Transitions()).Do()
+
+	assert.Equal([]string{"enter", "exit", "enter"}, calls, "should exit and enter the state again")
+	assert.NotNil(first.Err(), "should cancel the previous context")
+	assert.Nil(st.Context().Err(), "should give the state a new context")
+}
+
 func TestSameStateTransition(t *testing.T) {
 	assert := assert.New(t)
 	sm := New()
@@ -137,6 +358,76 @@ func TestMissingTransition(t *testing.T) {
 	err := sm.Transition("foo")
 
 	assert.EqualError(err, "Invalid state: foo", "should return an error when state does not exist")
+	assert.True(errors.Is(err, ErrInvalidState), "should wrap ErrInvalidState")
+}
+
+func TestOnUnknownState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.OnUnknownState(func(name string) (*State, error) {
+		switch name {
+		case "foo":
+			return sm.NewState().FromAny().To(name), nil
+		case "bar":
+			return &State{Destination: name, fromAny: true}, nil
+		case "baz":
+			return nil, errors.New("unknown workflow step")
+		}
+		return nil, nil
+	})
+
+	assert.Nil(sm.Transition("foo"), "should transition to a state defined on demand")
+	assert.Len(sm.States, 1, "should keep states defined by NewState once")
+
+	assert.Nil(sm.Transition("bar"), "should transition to a returned state")
+	assert.Len(sm.States, 2, "should add returned states to the machine")
+
+	assert.EqualError(sm.Transition("baz"), "unknown workflow step", "should return the resolver error")
+	assert.EqualError(sm.Transition("qux"), "Invalid state: qux", "should fail when nothing is resolved")
+}
+
+func TestOnUnknownStateConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.OnUnknownState(func(name string) (*State, error) {
+		return &State{Destination: name, fromAny: true}, nil
+	})
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			sm.Transition(fmt.Sprintf("step%d", i))
+		}
+		close(done)
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			sm.Find("step0")
+			sm.ForEachState(func(*State) bool { return true })
+			sm.MarshalJSON()
+		}
+	}
+	assert.Len(sm.States, 50, "should add every resolved state")
 }
 
 func TestCancelContext(t *testing.T) {
@@ -233,30 +524,916 @@ func TestValidTransition(t *testing.T) {
 	assert.Nil(err, "should not return an error")
 }
 
-func TestNewState(t *testing.T) {
+func TestDefaultOnEnter(t *testing.T) {
 	assert := assert.New(t)
 	sm := New()
-	assert.Len(sm.States, 0, "should start with no states")
+	entered := make(chan string, 2)
 
-	st := sm.NewState()
-	assert.Len(sm.States, 1, "should insert new state")
-	assert.NotNil(st, "should return new state")
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.DefaultOnEnter(func(st *State) {
+		entered <- "default:" + st.Destination
+	})
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar").OnEnter(func(st *State) {
+		entered <- "own:" + st.Destination
+	})
+
+	sm.Transition("foo")
+	assert.Equal("default:foo", <-entered, "should call default when state has no OnEnter")
+
+	sm.Transition("bar")
+	assert.Equal("own:bar", <-entered, "should not call default when state has an OnEnter")
 }
 
-func TestWithContext(t *testing.T) {
+func TestDefaultOnEnterBefore(t *testing.T) {
 	assert := assert.New(t)
-	ctx := context.Background()
+	sm := New()
+	entered := make(chan string, 2)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.DefaultOnEnter(func(st *State) {
+		entered <- "default:" + st.Destination
+	}, DefaultEnterBefore)
+	sm.NewState().From("bar").To("foo").OnEnter(func(st *State) {
+		entered <- "own:" + st.Destination
+	})
+
+	sm.Transition("foo")
+	assert.Equal("default:foo", <-entered, "should call default first")
+	assert.Equal("own:foo", <-entered, "should call own OnEnter after default")
+}
+
+func TestTransitionFilter(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.NewState().From("foo").To("baz")
+	sm.SetTransitionFilter(func(from, to string) bool {
+		return to != "baz"
+	})
+
+	assert.Nil(sm.Transition("foo"), "should allow transitions passing the filter")
+
+	err := sm.Transition("baz")
+	assert.True(errors.Is(err, ErrFiltered), "should reject with ErrFiltered")
+	assert.EqualError(err, "Transition filtered: foo > baz", "should name the rejected transition")
+	assert.Equal("foo", sm.Name(), "should not change state when filtered")
+
+	err = sm.Transition("qux")
+	assert.EqualError(err, "Invalid state: qux", "should run structural checks before the filter")
+}
+
+func TestProcessNext(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := false
+
+	sm.NewState().From("bar").To("foo").OnEnter(func(*State) {
+		entered = true
+	})
+
+	processed, err := sm.ProcessNext()
+	assert.False(processed, "should report nothing processed when queue is empty")
+	assert.Nil(err, "should not return an error")
+
+	sm.Transition("foo")
+	assert.False(entered, "should not enter before being processed")
+
+	processed, err = sm.ProcessNext()
+	assert.True(processed, "should report a processed transition")
+	assert.Nil(err, "should not return an error")
+	assert.True(entered, "should call on enter function")
+}
+
+func TestProcessNextCancelled(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
 	sm := New().WithContext(ctx)
+	cancel()
 
-	// Initial test.
-	assert.NotNil(sm.ctx, "should have context")
-	assert.NotNil(sm.cancel, "should have cancel func")
+	processed, err := sm.ProcessNext()
+	assert.False(processed, "should not process when context is done")
+	assert.EqualError(err, "context canceled", "should return the context error")
 }
 
-func TestNew(t *testing.T) {
+func TestExclusiveState(t *testing.T) {
 	assert := assert.New(t)
 	sm := New()
+	entered := make(chan bool)
+	finish := make(chan bool)
 
-	// Initial test.
-	assert.NotNil(sm.transitions, "new state machine should have transitions channel")
+	sm.NewState().From("foo").To("bar")
+	sm.NewState().From("bar").To("foo").Parallel(true).Exclusive().OnEnter(func(*State) {
+		entered <- true
+		<-finish
+	})
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.Transition("bar")
+	sm.Transition("foo")
+	<-entered
+	sm.Transition("bar")
+
+	err := sm.Transition("foo")
+	assert.True(errors.Is(err, ErrStateBusy), "should reject entering a busy exclusive state")
+	assert.EqualError(err, "State busy: foo", "should name the busy state")
+
+	finish <- true
+	assert.Eventually(func() bool {
+		return sm.Transition("foo") == nil
+	}, time.Second, time.Millisecond, "should allow entering once the handler completes")
+	<-entered
+	finish <- true
+}
+
+func TestStateComparator(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithStateComparator(func(a, b string) bool {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	})
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From(" foo ").To("bar")
+
+	st, err := sm.Find("foo ")
+	assert.Nil(err, "should find state using the comparator")
+	assert.Equal("foo", st.Destination, "should return the defined state")
+
+	sm.Transition(" foo")
+	assert.True(sm.Match("foo\t"), "should match using the comparator")
+	assert.Nil(sm.Transition("bar"), "should compare sources using the comparator")
+}
+
+func TestTransitionAs(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().From("draft").To("approved").RequireRole("manager", "admin")
+	sm.Transition("draft")
+
+	err := sm.Transition("approved")
+	assert.True(errors.Is(err, ErrForbidden), "should forbid transitions without roles")
+
+	err = sm.TransitionAs([]string{"author"}, "approved")
+	assert.EqualError(err, "Forbidden transition: draft > approved", "should forbid callers without a required role")
+	assert.Equal("draft", sm.Name(), "should not change state")
+
+	err = sm.TransitionAs([]string{"author", "admin"}, "approved")
+	assert.Nil(err, "should allow callers holding a required role")
+	assert.Equal("approved", sm.Name(), "should change state")
+}
+
+func TestInvariant(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("error")
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.Invariant(func(m *StateMachine) error {
+		if m.Match("bar") {
+			return errors.New("bar is not allowed")
+		}
+		return nil
+	})
+	sm.InvariantState("error")
+
+	sm.Transition("foo")
+	assert.Equal("foo", sm.Name(), "should keep state when invariants hold")
+
+	sm.Transition("bar")
+	assert.EqualError(<-sm.Errors(), "Invariant violated in bar: bar is not allowed", "should emit violations")
+	assert.Equal("error", sm.Name(), "should transition to the invariant state")
+}
+
+func TestNewState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	assert.Len(sm.States, 0, "should start with no states")
+
+	st := sm.NewState()
+	assert.Len(sm.States, 1, "should insert new state")
+	assert.NotNil(st, "should return new state")
+}
+
+func TestWithContext(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	sm := New().WithContext(ctx)
+
+	// Initial test.
+	assert.NotNil(sm.ctx, "should have context")
+	assert.NotNil(sm.cancel, "should have cancel func")
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Initial test.
+	assert.NotNil(sm.transitions, "new state machine should have transitions channel")
+}
+
+func TestNewWithBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(1, cap(New().transitions), "should buffer one transition by default")
+	assert.Equal(8, cap(NewWithBuffer(8).transitions), "should use the buffer size")
+	assert.Equal(1, cap(NewWithBuffer(0).transitions), "should use the default for a size of 0")
+	assert.Equal(0, cap(NewWithBuffer(Unbuffered).transitions), "should not buffer when requested")
+}
+
+func TestStart(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	var started *State
+
+	sm.NewState().FromStart().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.OnStart(func(st *State) {
+		started = st
+	})
+
+	assert.False(sm.Started(), "should not be started before Start")
+	err := sm.Start()
+
+	assert.Nil(err, "should not return an error")
+	assert.True(sm.Started(), "should be started")
+	assert.NotNil(started, "should call the start function")
+	assert.Equal(started, sm.CurrentState, "should enter the start state")
+	assert.Equal(StartName, sm.InitialStateName(), "should report the start state as initial")
+	assert.True(sm.initialized, "should launch the state machine")
+	assert.EqualError(sm.Transition("bar"), "Invalid state change:  > bar", "should only allow FromStart states")
+	assert.Nil(sm.Transition("foo"), "should allow FromStart states")
+}
+
+func TestStartMissingOnStart(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+
+	err := sm.Start()
+
+	assert.Equal(ErrMissingOnStart, err, "should return an error without a start function")
+	assert.False(sm.Started(), "should not be started without a start function")
+	assert.True(sm.initialized, "should still launch the state machine")
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	starts := 0
+
+	sm.NewState().FromStart().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.OnStart(func(*State) {
+		starts++
+	})
+
+	sm.Start()
+	start := sm.CurrentState
+	sm.Transition("foo")
+	sm.Transition("bar")
+	bar := sm.CurrentState
+	err := sm.Reset()
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal(2, starts, "should call the start function again")
+	assert.NotEqual(start, sm.CurrentState, "should enter a new start state")
+	assert.NotNil(sm.CurrentState.Context(), "should give the start state a context")
+	assert.NotNil(bar.Context().Err(), "should cancel the current state context")
+	assert.Nil(sm.PreviousState(), "should clear the previous state")
+	assert.Len(sm.States, 2, "should keep the state definitions")
+	assert.Nil(sm.Transition("foo"), "should allow FromStart states")
+}
+
+func TestResetMissingOnStart(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+
+	assert.Equal(ErrMissingOnStart, sm.Reset(), "should return an error without a start function")
+}
+
+func TestStartAsync(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	release := make(chan bool)
+
+	sm.OnStart(func(*State) {
+		<-release
+	})
+
+	result := sm.StartAsync()
+	select {
+	case <-result:
+		assert.Fail("should not complete before the start function returns")
+	default:
+	}
+
+	close(release)
+	assert.Nil(<-result, "should signal completion")
+}
+
+func TestStartAsyncCancelled(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	sm := New().WithContext(ctx)
+	release := make(chan bool)
+	defer close(release)
+
+	sm.OnStart(func(*State) {
+		<-release
+	})
+
+	result := sm.StartAsync()
+	cancel()
+
+	assert.EqualError(<-result, "context canceled", "should return the context error")
+}
+
+func TestStopCancelsStates(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	running := make(chan bool)
+	stopped := make(chan bool)
+
+	sm.NewState().FromAny().To("foo").Parallel(true).OnEnter(func(st *State) {
+		running <- true
+		<-st.Context().Done()
+		stopped <- true
+	})
+	sm.NewState().FromAny().To("bar")
+
+	// Enter with a request context so the state context is not derived from
+	// a machine context.
+	sm.TransitionCtx(context.Background(), "foo")
+	<-running
+
+	sm.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		assert.Fail("should cancel the context of running handlers")
+	}
+}
+
+func TestStopGoroutines(t *testing.T) {
+	assert := assert.New(t)
+	before := runtime.NumGoroutine()
+	sm := New().WithContext(context.Background())
+	running := make(chan bool)
+
+	sm.NewState().FromAny().To("foo").Parallel(true).OnEnter(func(st *State) {
+		running <- true
+		<-st.Context().Done()
+	})
+	sm.NewState().FromAny().To("bar").Timeout(time.Hour, "foo")
+	sm.Initialize()
+
+	sm.Transition("foo")
+	<-running
+	sm.Transition("bar")
+
+	sm.Stop()
+
+	// Poll here rather than with Eventually, which runs the condition in a
+	// goroutine of its own.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(runtime.NumGoroutine() <= before, "should not leak goroutines")
+}
+
+func TestStop(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.Transition("foo")
+
+	sm.Stop()
+	sm.Stop()
+
+	assert.True(sm.Stopped(), "should be stopped")
+	assert.Equal(0, sm.QueueDepth(), "should discard queued transitions")
+	err := sm.Transition("bar")
+	assert.True(errors.Is(err, ErrStopped), "should reject transitions once stopped")
+	assert.EqualError(err, "State machine stopped: bar", "should name the rejected state")
+	assert.Equal("foo", sm.Name(), "should not change state")
+}
+
+func TestProposeTransition(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.NewState().From("qux").To("baz")
+	sm.Transition("foo")
+
+	_, _, err := sm.ProposeTransition("baz")
+	assert.EqualError(err, "Invalid state change: foo > baz", "should validate the proposal")
+
+	tr, commit, err := sm.ProposeTransition("bar")
+	assert.Nil(err, "should not return an error")
+	assert.Equal("foo", tr.From.Destination, "should prepare the transition source")
+	assert.Equal("bar", tr.To.Destination, "should prepare the transition destination")
+	assert.Equal("foo", sm.Name(), "should not change state before commit")
+
+	assert.Nil(commit(), "should commit the transition")
+	assert.Equal("bar", sm.Name(), "should change state on commit")
+}
+
+func TestProposeTransitionStateChanged(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.NewState().FromAny().To("baz")
+	sm.Transition("foo")
+
+	_, commit, _ := sm.ProposeTransition("bar")
+	sm.Transition("baz")
+
+	err := commit()
+	assert.True(errors.Is(err, ErrStateChanged), "should return ErrStateChanged")
+	assert.EqualError(err, "State changed: foo > baz", "should name the states")
+	assert.Equal("baz", sm.Name(), "should not commit the proposal")
+}
+
+func TestProposeTransitionConcurrentCommits(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < 50; i++ {
+		sm := New()
+
+		// Execute transitions.
+		go func() {
+			for transition := range sm.Transitions() {
+				transition.Do()
+			}
+		}()
+
+		sm.NewState().FromAny().To("foo")
+		sm.NewState().FromAny().To("bar")
+		sm.NewState().FromAny().To("baz")
+		sm.Transition("foo")
+
+		_, commitBar, _ := sm.ProposeTransition("bar")
+		_, commitBaz, _ := sm.ProposeTransition("baz")
+
+		errs := make(chan error, 2)
+		go func() { errs <- commitBar() }()
+		go func() { errs <- commitBaz() }()
+
+		changed := 0
+		for j := 0; j < 2; j++ {
+			if errors.Is(<-errs, ErrStateChanged) {
+				changed++
+			}
+		}
+		assert.Equal(1, changed, "should commit only one proposal from the same state")
+	}
+}
+
+func TestInitialStateName(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	assert.Equal("", sm.InitialStateName(), "should be empty before any state is entered")
+
+	sm.Transition("foo")
+	sm.Transition("bar")
+	assert.Equal("foo", sm.InitialStateName(), "should report the first state entered")
+}
+
+func TestInitialStateNameConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+
+	go sm.Transition("foo")
+
+	assert.Eventually(func() bool {
+		return sm.InitialStateName() == "foo"
+	}, time.Second, 10*time.Millisecond, "should read the initial state while transitioning")
+}
+
+func TestOnComplete(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	completed := []string{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("done").To("running")
+	sm.NewState().From("running").To("done").Final()
+	sm.NewState().FromAny().To("failed").Final().OnEnterE(func(*State) error {
+		return errors.New("Failed")
+	})
+	sm.OnComplete(func(st *State) {
+		completed = append(completed, st.Destination)
+	})
+
+	assert.Nil(sm.TransitionSync("running"))
+	assert.False(sm.IsTerminal(), "should not be terminal in a non-final state")
+	assert.Nil(sm.TransitionSync("done"))
+	assert.True(sm.IsTerminal(), "should be terminal in a final state")
+	assert.Equal([]string{"done"}, completed, "should call OnComplete when entering a final state")
+
+	assert.NotNil(sm.TransitionSync("failed"))
+	assert.Equal([]string{"done"}, completed, "should not call OnComplete when entering fails")
+}
+
+func TestExceptFrom(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("running")
+	sm.NewState().From("running").To("completed")
+	sm.NewState().FromAny().ExceptFrom("completed").To("error")
+
+	assert.Nil(sm.Transition("running"))
+	assert.True(sm.Can("error"), "should allow transitions from other sources")
+
+	assert.Nil(sm.Transition("completed"))
+	assert.False(sm.Can("error"), "should reject transitions from excluded sources")
+	assert.NotNil(sm.Transition("error"), "should reject transitions from excluded sources")
+	assert.True(sm.Match("completed"))
+}
+
+func TestOnEnterCtx(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	cancelled := make(chan struct{})
+	exited := make(chan context.Context, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").Parallel(true).OnEnterCtx(func(ctx context.Context, st *State) {
+		<-ctx.Done()
+		close(cancelled)
+	}).OnExitCtx(func(ctx context.Context, st *State) {
+		exited <- ctx
+	})
+	sm.NewState().From("foo").To("bar")
+
+	assert.Nil(sm.Transition("foo"))
+	assert.Nil(sm.TransitionSync("bar"))
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		assert.Fail("should cancel the context once the state is left")
+	}
+	ctx := <-exited
+	assert.NotNil(ctx, "should pass a context to the exit function")
+	assert.Nil(ctx.Err(), "should pass a context which is not cancelled")
+}
+
+func TestBeforeTransitionParallel(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	before := make(chan string, 2)
+	after := make(chan string, 2)
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Parallel(true)
+	sm.BeforeTransition(func(t *Transition) {
+		before <- t.To.Destination
+	})
+	sm.AfterTransition(func(t *Transition) {
+		after <- t.To.Destination
+	})
+	sm.Initialize()
+
+	sm.Transition("foo")
+	assert.Equal("foo", <-before, "should call the before action for regular states")
+	assert.Equal("foo", <-after, "should call the after action for regular states")
+
+	sm.Transition("bar")
+	assert.Equal("bar", <-before, "should call the before action for parallel states")
+	assert.Equal("bar", <-after, "should call the after action for parallel states")
+}
+
+func TestTransitionContextDone(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	sm := New().WithContext(ctx)
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.Initialize()
+
+	assert.Nil(sm.Transition("foo"))
+	cancel()
+
+	err := sm.Transition("bar")
+	assert.True(errors.Is(err, ErrContextDone), "should reject transitions once the context is done")
+	assert.Equal("foo", sm.Name(), "should not advance the current state")
+}
+
+func TestStartWithoutContext(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	started := make(chan bool, 1)
+
+	sm.OnStart(func(*State) {
+		started <- true
+	})
+	sm.NewState().FromStart().To("foo")
+
+	assert.NotPanics(func() {
+		assert.Nil(sm.Start())
+	}, "should start machines without a context")
+	assert.True(<-started, "should call the start function")
+	assert.Nil(sm.TransitionSync("foo"), "should execute transitions")
+
+	sm.Stop()
+	assert.NotNil(sm.ctx.Err(), "should stop the executor")
+}
+
+func TestStartIn(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := []string{}
+
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft").To("review").OnEnter(func(st *State) {
+		calls = append(calls, "enter "+st.Destination)
+	})
+	sm.NewState().From("review").To("published")
+	sm.OnStart(func(st *State) {
+		calls = append(calls, "start "+st.Destination)
+	})
+
+	assert.True(errors.Is(sm.StartIn("unknown"), ErrInvalidState), "should reject undefined states")
+
+	assert.Nil(sm.StartIn("review"))
+	assert.Equal([]string{"enter review", "start review"}, calls, "should enter the state before calling OnStart")
+	assert.True(sm.Match("review"), "should begin in the named state")
+	assert.True(sm.Started())
+	assert.Equal("review", sm.InitialStateName())
+	assert.NotNil(sm.CurrentState.Context(), "should give the state a context")
+
+	assert.Nil(sm.TransitionSync("published"), "should transition from the named state")
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("Draft")
+	sm.NewState().From("Draft").To("Review")
+
+	_, err := sm.Find("draft")
+	assert.NotNil(err, "should compare exactly by default")
+
+	sm.CaseInsensitive(true)
+	st, err := sm.Find("draft")
+	assert.Nil(err, "should find states ignoring case")
+	assert.Equal("Draft", st.Destination, "should keep the defined name")
+
+	assert.Nil(sm.TransitionSync("DRAFT"))
+	assert.True(sm.Match("draft"), "should match ignoring case")
+	assert.Equal("Draft", sm.Name(), "should report the defined name")
+
+	options := sm.AvailableTransitions()
+	assert.Equal("Review", options[len(options)-1].Name, "should list the defined names")
+	assert.Contains(sm.ExportDOT(), `"Review"`, "should export the defined names")
+
+	sm.CaseInsensitive(false)
+	assert.False(sm.Match("draft"), "should compare exactly again")
+}
+
+func TestIDs(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.EnableHistory(10)
+	ids := make(chan uint64, 2)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			ids <- transition.ID
+			transition.Do()
+		}
+	}()
+
+	foo := sm.NewState().FromAny().To("foo")
+	bar := sm.NewState().From("foo").To("bar")
+	assert.Equal(1, foo.ID, "should number states in creation order")
+	assert.Equal(2, bar.ID, "should number states in creation order")
+
+	sm.Transition("foo")
+	sm.Transition("bar")
+	assert.Equal(uint64(1), <-ids, "should number transitions")
+	assert.Equal(uint64(2), <-ids, "should number transitions")
+
+	history := sm.History()
+	assert.Equal(uint64(2), history[len(history)-1].ID, "should record the transition ID")
+}
+
+func TestSequence(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().Sequence("draft", "review", "approved", "published")
+	sm.OnStart(func(*State) {})
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	assert.Len(sm.States, 4, "should define a state per name")
+	assert.Nil(sm.Start())
+	assert.NotNil(sm.TransitionSync("review"), "should not skip steps")
+	for _, name := range []string{"draft", "review", "approved", "published"} {
+		assert.Nil(sm.TransitionSync(name), "should walk the sequence")
+	}
+
+	sm.NewState().From("published").To("review")
+	assert.Nil(sm.TransitionSync("review"), "should allow branching back into the sequence")
+}
+
+func TestString(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.OnStart(func(*State) {})
+
+	draft := sm.NewState().FromStart().To("draft")
+	review := sm.NewState().From("draft").To("review").Final().Parallel(true)
+	archived := sm.NewState().FromAny().To("archived")
+
+	assert.Equal("State(draft, from=[], flags=start)", draft.String())
+	assert.Equal("State(review, from=[draft], flags=final|parallel)", review.String())
+	assert.Equal("State(archived, from=[], flags=any)", archived.String())
+	assert.Equal("<nil>", (*State)(nil).String(), "should handle nil states")
+
+	sm.Start()
+	assert.Equal(StartName, sm.CurrentState.String(), "should describe the start state")
+
+	assert.Equal("<start> -> draft", (&Transition{From: sm.CurrentState, To: draft}).String())
+	assert.Equal("<start> -> draft", (&Transition{To: draft}).String(), "should handle transitions without a source")
+	assert.Equal("draft -> review", fmt.Sprint(&Transition{From: draft, To: review}))
+}
+
+func TestBeforeTransitionE(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	calls := make(chan string, 4)
+	errDenied := errors.New("Denied")
+
+	sm.NewState().FromAny().To("foo").OnExit(func(*State) {
+		calls <- "exit foo"
+	})
+	sm.NewState().From("foo").To("bar").OnEnter(func(*State) {
+		calls <- "enter bar"
+	})
+	sm.BeforeTransitionE(func(t *Transition) error {
+		if t.To.Destination == "bar" {
+			return errDenied
+		}
+		return nil
+	})
+	sm.Initialize()
+
+	assert.Nil(sm.TransitionSync("foo"))
+	assert.Equal(errDenied, sm.TransitionSync("bar"), "should return the veto to a waiting caller")
+	assert.True(sm.Match("foo"), "should revert to the previous state")
+
+	assert.Nil(sm.Transition("bar"))
+	assert.Equal(errDenied, <-sm.Errors(), "should send the veto to the errors channel")
+	assert.True(sm.Match("foo"), "should revert to the previous state")
+	assert.Len(calls, 0, "should not call exit or enter functions")
+}
+
+func TestStopReleasesWaiters(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().To("foo")
+
+	done := make(chan error)
+	go func() {
+		done <- sm.TransitionSync("foo")
+	}()
+	assert.Eventually(func() bool {
+		return sm.QueueDepth() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	sm.Stop()
+	select {
+	case err := <-done:
+		assert.Equal(ErrStopped, err, "should release callers waiting for discarded transitions")
+	case <-time.After(time.Second):
+		assert.Fail("should not block after stop")
+	}
 }
@@ -0,0 +1,70 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsmtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/edge/fsm"
+)
+
+// Drive executes the transitions of sm in a new goroutine until the test ends.
+func Drive(t testing.TB, sm *fsm.StateMachine) {
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+	})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case transition := <-sm.Transitions():
+				transition.Do()
+			}
+		}
+	}()
+}
+
+// AssertSequence transitions sm to each step in turn, waiting for the step to
+// be entered, and fails the test at the first step that is rejected or not
+// reached. The transitions must be executed, such as by Drive.
+func AssertSequence(t testing.TB, sm *fsm.StateMachine, steps ...string) bool {
+	t.Helper()
+	for i, step := range steps {
+		if err := sm.TransitionSync(step); err != nil {
+			t.Errorf("Step %d: transition to %v failed: %v", i, step, err)
+			return false
+		}
+		if !sm.Match(step) {
+			t.Errorf("Step %d: expected state %v, got %v", i, step, sm.Name())
+			return false
+		}
+	}
+	return true
+}
+
+// AssertRejected fails the test unless a transition of sm to the named state is
+// rejected as invalid, leaving the current state unchanged. Other errors, such
+// as ErrStopped, fail the test.
+func AssertRejected(t testing.TB, sm *fsm.StateMachine, to string) bool {
+	t.Helper()
+	from := sm.Name()
+	err := sm.TransitionSync(to)
+	if err == nil {
+		t.Errorf("Transition %v > %v should be rejected", from, to)
+		return false
+	}
+	if !errors.Is(err, fsm.ErrInvalidStateChange) && !errors.Is(err, fsm.ErrInvalidState) && !errors.Is(err, fsm.ErrForbidden) {
+		t.Errorf("Transition %v > %v failed with %v, expected an invalid transition", from, to, err)
+		return false
+	}
+	if name := sm.Name(); name != from {
+		t.Errorf("Rejected transition %v > %v changed the state to %v", from, to, name)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package fsmtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/edge/fsm"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder captures the errors reported to it instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newMachine(t *testing.T) *fsm.StateMachine {
+	sm := fsm.New().Sequence("draft", "review", "published")
+	Drive(t, sm)
+	return sm
+}
+
+func TestAssertSequence(t *testing.T) {
+	assert := assert.New(t)
+	sm := newMachine(t)
+
+	assert.True(AssertSequence(t, sm, "draft", "review", "published"), "should pass for legal sequences")
+
+	r := &recorder{TB: t}
+	sm = newMachine(t)
+	assert.False(AssertSequence(r, sm, "draft", "published"), "should fail for illegal sequences")
+	assert.Len(r.errors, 1, "should report the failing step")
+}
+
+func TestAssertRejected(t *testing.T) {
+	assert := assert.New(t)
+	sm := newMachine(t)
+	AssertSequence(t, sm, "draft")
+
+	assert.True(AssertRejected(t, sm, "published"), "should pass for rejected transitions")
+
+	r := &recorder{TB: t}
+	assert.False(AssertRejected(r, sm, "review"), "should fail for permitted transitions")
+	assert.Equal([]string{"Transition draft > review should be rejected"}, r.errors)
+
+	r = &recorder{TB: t}
+	sm.Stop()
+	assert.False(AssertRejected(r, sm, "published"), "should fail for errors other than invalid transitions")
+	assert.Len(r.errors, 1, "should report the unexpected error")
+}
@@ -0,0 +1,163 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnreachable is returned when no chain of transitions leads to a state.
+var ErrUnreachable = errors.New("State unreachable")
+
+// definedStates returns the first definition of every destination name.
+func (s *StateMachine) definedStates() []*State {
+	states := []*State{}
+	seen := map[string]bool{}
+	for _, st := range s.definitions() {
+		if !seen[st.Destination] {
+			seen[st.Destination] = true
+			states = append(states, st)
+		}
+	}
+	return states
+}
+
+// successors returns the states that can structurally be entered from the
+// given state, ignoring guards. A nil state permits any entrypoint.
+func (s *StateMachine) successors(from *State) []*State {
+	next := []*State{}
+	for _, st := range s.definedStates() {
+		if st == from {
+			continue
+		}
+		if s.permitsSource(from, st) {
+			next = append(next, st)
+		}
+	}
+	return next
+}
+
+// distances walks the graph breadth first from the given state, returning
+// the previous state on the shortest path to every reachable state along with
+// the order in which they were found.
+func (s *StateMachine) distances(from *State) (map[*State]*State, []*State) {
+	prev := map[*State]*State{}
+	order := []*State{}
+	queue := []*State{from}
+	visited := map[*State]bool{from: true}
+
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+
+		for _, st := range s.successors(from) {
+			if visited[st] {
+				continue
+			}
+			visited[st] = true
+			prev[st] = from
+			order = append(order, st)
+			queue = append(queue, st)
+		}
+	}
+	return prev, order
+}
+
+// StepsToFinish returns the minimum number of transitions from the current
+// state to any final state, ignoring guards.
+func (s *StateMachine) StepsToFinish() (int, error) {
+	if s.IsFinished() {
+		return 0, nil
+	}
+
+	current := s.current()
+	prev, order := s.distances(current)
+	for _, st := range order {
+		if !st.final {
+			continue
+		}
+
+		steps := 0
+		for at := st; at != current; at = prev[at] {
+			steps++
+		}
+		return steps, nil
+	}
+
+	return 0, fmt.Errorf("%w: no final state from %v", ErrUnreachable, s.Name())
+}
+
+// CanReach returns true when a chain of transitions leads from the current state
+// to target, ignoring guards.
+func (s *StateMachine) CanReach(target string) bool {
+	_, err := s.PathTo(target)
+	return err == nil
+}
+
+// PathTo returns the destinations of the shortest chain of transitions from the
+// current state to target, ignoring guards. The path is empty when target is
+// the current state.
+func (s *StateMachine) PathTo(target string) ([]string, error) {
+	if s.Match(target) {
+		return []string{}, nil
+	}
+
+	st, err := s.Find(target)
+	if err != nil {
+		return nil, err
+	}
+	st = st.definition()
+
+	current := s.current()
+	prev, _ := s.distances(current)
+	if _, ok := prev[st]; !ok {
+		return nil, fmt.Errorf("%w: %v > %v", ErrUnreachable, s.Name(), target)
+	}
+
+	path := []string{}
+	for at := st; at != current; at = prev[at] {
+		path = append([]string{at.Destination}, path...)
+	}
+	return path, nil
+}
+
+// Cycles returns the simple cycles of the state graph, ignoring guards. Each
+// cycle starts at its earliest defined state and cycles are ordered by their
+// first state and then by the definition order of the following states.
+func (s *StateMachine) Cycles() [][]string {
+	states := s.definedStates()
+	order := make(map[*State]int, len(states))
+	for i, st := range states {
+		order[st] = i
+	}
+
+	cycles := [][]string{}
+	for i, start := range states {
+		path := []*State{start}
+		onPath := map[*State]bool{start: true}
+
+		var walk func(from *State)
+		walk = func(from *State) {
+			for _, next := range s.successors(from) {
+				switch {
+				case next == start:
+					cycle := make([]string, len(path))
+					for j, st := range path {
+						cycle[j] = st.Destination
+					}
+					cycles = append(cycles, cycle)
+				case order[next] > i && !onPath[next]:
+					path = append(path, next)
+					onPath[next] = true
+					walk(next)
+					onPath[next] = false
+					path = path[:len(path)-1]
+				}
+			}
+		}
+		walk(start)
+	}
+	return cycles
+}
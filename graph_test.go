@@ -0,0 +1,90 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGraphMachine() *StateMachine {
+	sm := New()
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft").To("review")
+	sm.NewState().From("review").To("approved")
+	sm.NewState().From("approved", "draft").To("published").Final()
+	sm.NewState().From("review").To("rejected")
+	return sm
+}
+
+func TestStepsToFinish(t *testing.T) {
+	assert := assert.New(t)
+	sm := newGraphMachine()
+
+	sm.CurrentState, _ = sm.Find("review")
+	steps, err := sm.StepsToFinish()
+	assert.Nil(err, "should not return an error")
+	assert.Equal(2, steps, "should count the shortest path")
+
+	sm.CurrentState, _ = sm.Find("draft")
+	steps, _ = sm.StepsToFinish()
+	assert.Equal(1, steps, "should prefer shortcuts")
+
+	sm.CurrentState, _ = sm.Find("published")
+	steps, _ = sm.StepsToFinish()
+	assert.Equal(0, steps, "should return zero in a final state")
+}
+
+func TestStepsToFinishUnreachable(t *testing.T) {
+	assert := assert.New(t)
+	sm := newGraphMachine()
+	sm.CurrentState, _ = sm.Find("rejected")
+
+	_, err := sm.StepsToFinish()
+
+	assert.True(errors.Is(err, ErrUnreachable), "should return ErrUnreachable")
+	assert.EqualError(err, "State unreachable: no final state from rejected", "should name the current state")
+}
+
+func TestPathTo(t *testing.T) {
+	assert := assert.New(t)
+	sm := newGraphMachine()
+	sm.CurrentState, _ = sm.Find("review")
+
+	path, err := sm.PathTo("published")
+	assert.Nil(err, "should not return an error")
+	assert.Equal([]string{"approved", "published"}, path, "should return the shortest path")
+
+	path, _ = sm.PathTo("review")
+	assert.Equal([]string{}, path, "should return an empty path to the current state")
+	assert.True(sm.CanReach("rejected"), "should reach successors")
+	assert.False(sm.CanReach("draft"), "should not reach states without a chain of transitions")
+
+	_, err = sm.PathTo("draft")
+	assert.True(errors.Is(err, ErrUnreachable), "should return ErrUnreachable")
+	assert.EqualError(err, "State unreachable: review > draft", "should name the unreachable state")
+
+	_, err = sm.PathTo("missing")
+	assert.EqualError(err, "Invalid state: missing", "should return an error for unknown states")
+}
+
+func TestCycles(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().From("c").To("a")
+	sm.NewState().From("a", "c").To("b")
+	sm.NewState().From("b").To("c")
+	sm.NewState().From("c").To("d")
+
+	assert.Equal([][]string{{"a", "b", "c"}, {"b", "c"}}, sm.Cycles(), "should list simple cycles deterministically")
+}
+
+func TestCyclesAcyclic(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft").To("review")
+	sm.NewState().From("review").To("published")
+
+	assert.Empty(sm.Cycles(), "should not find cycles in a pipeline")
+}
@@ -0,0 +1,65 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrExclusiveGroup is returned when a transition would leave the machine in
+// more than one state of an exclusive group.
+var ErrExclusiveGroup = errors.New("Exclusive group violated")
+
+// ExclusiveGroup declares that the machine must never be in more than one of
+// the named states at a time. The machine occupies its current state along with
+// the parents of it, so the check becomes relevant for nested states.
+func (s *StateMachine) ExclusiveGroup(names ...string) {
+	s.groups = append(s.groups, names)
+}
+
+// activeStates returns the names of the states occupied while st is current.
+func (s *StateMachine) activeStates(st *State) []string {
+	active := []string{st.Destination}
+	for _, parent := range s.parents(st) {
+		active = append(active, parent.Destination)
+	}
+	return active
+}
+
+// checkGroups rejects entering st when it would occupy several states of an
+// exclusive group.
+func (s *StateMachine) checkGroups(st *State) error {
+	if len(s.groups) == 0 {
+		return nil
+	}
+
+	active := s.activeStates(st)
+	for _, group := range s.groups {
+		if err := s.groupConflict(active, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupConflict returns an error when more than one of the active states is
+// part of group.
+func (s *StateMachine) groupConflict(active, group []string) error {
+	conflict := []string{}
+	for _, a := range active {
+		for _, name := range group {
+			if s.equal(name, a) {
+				conflict = append(conflict, a)
+				break
+			}
+		}
+	}
+
+	if len(conflict) > 1 {
+		return fmt.Errorf("%w: %v", ErrExclusiveGroup, strings.Join(conflict, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExclusiveGroup(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.ExclusiveGroup("foo", "bar")
+
+	assert.Nil(sm.Transition("foo"), "should allow a single state of the group")
+	assert.Nil(sm.Transition("bar"), "should allow moving between states of the group")
+}
+
+func TestExclusiveGroupParent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("running")
+	sm.NewState().FromAny().To("busy").Parent("running")
+	sm.ExclusiveGroup("running", "busy")
+
+	errs := sm.Validate()
+	assert.Len(errs, 1, "should report groups naming a state along with its parent")
+	assert.True(errors.Is(errs[0], ErrExclusiveGroup), "should return ErrExclusiveGroup")
+
+	assert.Nil(sm.Transition("running"), "should allow a single state of the group")
+	err := sm.Transition("busy")
+	assert.True(errors.Is(err, ErrExclusiveGroup), "should reject occupying several states of the group")
+	assert.EqualError(err, "Exclusive group violated: busy, running", "should name the conflicting states")
+	assert.Equal("running", sm.Name(), "should not change state")
+}
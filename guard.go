@@ -0,0 +1,54 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrGuardRejected is returned when a state guard vetoes a transition.
+var ErrGuardRejected = errors.New("Guard rejected transition")
+
+// Guard decides at runtime whether a state may be entered.
+// Guards may run during validation, so they must be free of side effects.
+type Guard interface {
+	Allow(from, to *State) bool
+}
+
+// GuardFunc adapts a function to the Guard interface.
+type GuardFunc func(from, to *State) bool
+
+// Allow calls f(from, to).
+func (f GuardFunc) Allow(from, to *State) bool {
+	return f(from, to)
+}
+
+// GuardWith adds a guard to the state. Guards are evaluated in the order they
+// were added and the first rejection stops the evaluation.
+func (st *State) GuardWith(g Guard) *State {
+	st.guards = append(st.guards, g)
+	return st
+}
+
+// Guard adds a guard function to the state, see GuardWith. Guards may run
+// during validation, so f must be free of side effects.
+func (st *State) Guard(f func(from, to *State) bool) *State {
+	return st.GuardWith(GuardFunc(f))
+}
+
+// checkGuards runs the guards of the inbound state.
+func (s *StateMachine) checkGuards(from, st *State) error {
+	for i, g := range st.guards {
+		started := time.Now()
+		allowed := g.Allow(from, st)
+		s.guardTimed(GuardKey{From: from.name(), To: st.Destination, Index: i}, time.Since(started))
+
+		if !allowed {
+			return fmt.Errorf("%w: %v > %v", ErrGuardRejected, from.name(), st.Destination)
+		}
+	}
+	return nil
+}
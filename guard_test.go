@@ -0,0 +1,93 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardWith(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := []string{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").
+		GuardWith(GuardFunc(func(from, to *State) bool {
+			calls = append(calls, "first")
+			return false
+		})).
+		GuardWith(GuardFunc(func(from, to *State) bool {
+			calls = append(calls, "second")
+			return true
+		}))
+
+	sm.Transition("foo")
+	err := sm.Transition("bar")
+
+	assert.True(errors.Is(err, ErrGuardRejected), "should reject with ErrGuardRejected")
+	assert.EqualError(err, "Guard rejected transition: foo > bar", "should name the rejected transition")
+	assert.Equal([]string{"first"}, calls, "should stop at the first rejecting guard")
+	assert.Equal("foo", sm.Name(), "should not change state")
+}
+
+func TestGuard(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	items := 0
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("cart")
+	sm.NewState().From("cart").To("shipping").Guard(func(from, to *State) bool {
+		return items > 0
+	})
+
+	sm.Transition("cart")
+	err := sm.Transition("shipping")
+	assert.EqualError(err, "Guard rejected transition: cart > shipping", "should reject when the guard fails")
+
+	items = 1
+	err = sm.Transition("shipping")
+	assert.Nil(err, "should allow the transition when the guard passes")
+	assert.Equal("shipping", sm.Name(), "should change state")
+}
+
+func TestGuardArguments(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	foo := sm.NewState().FromAny().To("foo")
+	var gotFrom, gotTo *State
+	bar := sm.NewState().From("foo").To("bar").GuardWith(GuardFunc(func(from, to *State) bool {
+		gotFrom, gotTo = from, to
+		return true
+	}))
+
+	sm.Transition("foo")
+	err := sm.Transition("bar")
+
+	assert.Nil(err, "should allow the transition")
+	assert.Equal(foo, gotFrom, "should pass the current state")
+	assert.Equal(bar, gotTo, "should pass the inbound state")
+}
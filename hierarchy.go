@@ -0,0 +1,98 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// Parent nests the state within the state with the given destination. The
+// machine is in the parent whenever it is in one of its children.
+//
+// Transitions between states with different parents exit and enter the
+// parents on the way: the state left exits first, followed by its parents from
+// the innermost outwards, up to the parent shared with the inbound state. Then
+// the parents of the inbound state are entered from the outermost inwards,
+// followed by the inbound state itself. Parents shared by both states are
+// neither exited nor entered.
+func (st *State) Parent(name string) *State {
+	st.parent = name
+	return st
+}
+
+// IsIn returns true when the current state is the named state or nested
+// within it.
+func (s *StateMachine) IsIn(parent string) bool {
+	current := s.current()
+	if current == nil {
+		return false
+	}
+	if s.equal(current.Destination, parent) {
+		return true
+	}
+	for _, p := range s.parents(current) {
+		if s.equal(p.Destination, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// parents returns the parents of st from the innermost outwards. Unknown
+// parents end the chain, as does a cycle.
+func (s *StateMachine) parents(st *State) []*State {
+	parents := []*State{}
+	seen := map[*State]bool{st: true}
+	for st.parent != "" {
+		defs := s.findDefinitions(st.parent)
+		if len(defs) == 0 || seen[defs[0]] {
+			break
+		}
+		parent := defs[0]
+		seen[parent] = true
+		parents = append(parents, parent)
+		st = parent
+	}
+	return parents
+}
+
+// exitedParents returns the parents left by the transition, from the innermost
+// outwards.
+func (t *Transition) exitedParents() []*State {
+	if t.machine == nil || t.From == nil {
+		return nil
+	}
+	return without(t.machine.parents(t.From), t.machine.parents(t.To))
+}
+
+// enteredParents returns the parents entered by the transition, from the
+// outermost inwards.
+func (t *Transition) enteredParents() []*State {
+	if t.machine == nil {
+		return nil
+	}
+	from := []*State{}
+	if t.From != nil {
+		from = t.machine.parents(t.From)
+	}
+	entered := without(t.machine.parents(t.To), from)
+	for i, j := 0, len(entered)-1; i < j; i, j = i+1, j-1 {
+		entered[i], entered[j] = entered[j], entered[i]
+	}
+	return entered
+}
+
+// without returns the states of a which are not in b.
+func without(a, b []*State) []*State {
+	result := []*State{}
+	for _, st := range a {
+		shared := false
+		for _, other := range b {
+			if st == other {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			result = append(result, st)
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := []string{}
+	record := func(call string) func(*State) {
+		return func(*State) {
+			calls = append(calls, call)
+		}
+	}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().To("active").OnEnter(record("enter active")).OnExit(record("exit active"))
+	sm.NewState().FromAny().To("running").Parent("active").
+		OnEnter(record("enter running")).OnExit(record("exit running"))
+	sm.NewState().From("running").To("paused").Parent("active").
+		OnEnter(record("enter paused")).OnExit(record("exit paused"))
+	sm.NewState().From("paused").To("done")
+
+	assert.False(sm.IsIn("active"), "should not be in a parent without a current state")
+
+	assert.Nil(sm.TransitionSync("running"))
+	assert.True(sm.IsIn("active"), "should be in the parent")
+	assert.True(sm.IsIn("running"), "should be in the current state")
+	assert.False(sm.IsIn("paused"), "should not be in a sibling")
+	assert.Equal([]string{"enter active", "enter running"}, calls, "should enter the parent first")
+
+	calls = []string{}
+	assert.Nil(sm.TransitionSync("paused"))
+	assert.Equal([]string{"exit running", "enter paused"}, calls, "should not leave a shared parent")
+
+	calls = []string{}
+	assert.Nil(sm.TransitionSync("done"))
+	assert.False(sm.IsIn("active"), "should have left the parent")
+	assert.Equal([]string{"exit paused", "exit active"}, calls, "should exit the parent last")
+}
+
+func TestParentCycle(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	foo := sm.NewState().To("foo").Parent("bar")
+	sm.NewState().To("bar").Parent("foo")
+
+	parents := sm.parents(foo)
+	assert.Len(parents, 1, "should stop at a cycle")
+	assert.Equal("bar", parents[0].Destination)
+}
@@ -0,0 +1,273 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrHistoryNotClearable is sent to the Errors channel when ClearHistory is
+// used with a store that does not implement HistoryClearer.
+var ErrHistoryNotClearable = errors.New("History store can not be cleared")
+
+// HistoryStore persists the transitions committed by a state machine.
+type HistoryStore interface {
+	// Append records a committed transition.
+	Append(*Transition) error
+	// All returns the recorded transitions, oldest first.
+	All() ([]*Transition, error)
+}
+
+// HistoryClearer is implemented by history stores supporting ClearHistory.
+type HistoryClearer interface {
+	Clear() error
+}
+
+// HistoryRetainer is implemented by history stores supporting RetainTransition.
+type HistoryRetainer interface {
+	Retain(func(*Transition) bool)
+}
+
+// HistoryEntry describes a committed transition.
+type HistoryEntry struct {
+	// ID is the ID of the transition.
+	ID   uint64
+	From string
+	To   string
+	Time time.Time
+}
+
+// MemoryHistory is an in-memory HistoryStore keeping the most recent transitions
+// in a ring buffer.
+type MemoryHistory struct {
+	mu      sync.Mutex
+	entries []*Transition
+	// start is the index of the oldest entry once the buffer is full.
+	start int
+	limit int
+	// retain exempts transitions from eviction. While it is set, entries are
+	// kept oldest first and evicted entries are left as nil until compacted.
+	retain func(*Transition) bool
+	// evictable holds the indexes of the entries not retained, oldest first.
+	evictable []int
+	// evicted is the number of nil entries.
+	evicted int
+}
+
+// NewMemoryHistory returns a MemoryHistory holding at most limit transitions.
+// A limit below one keeps every transition.
+func NewMemoryHistory(limit int) *MemoryHistory {
+	return &MemoryHistory{limit: limit}
+}
+
+// Append records a transition, dropping the oldest one when the buffer is full.
+func (h *MemoryHistory) Append(t *Transition) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.limit < 1 {
+		h.entries = append(h.entries, t)
+		return nil
+	}
+
+	if h.retain == nil {
+		if len(h.entries) < h.limit {
+			h.entries = append(h.entries, t)
+			return nil
+		}
+		h.entries[h.start] = t
+		h.start = (h.start + 1) % len(h.entries)
+		return nil
+	}
+
+	// Evict the oldest transition that is not retained. When every transition
+	// is retained the buffer grows beyond its limit.
+	if len(h.entries)-h.evicted >= h.limit && len(h.evictable) > 0 {
+		h.entries[h.evictable[0]] = nil
+		h.evictable = h.evictable[1:]
+		h.evicted++
+	}
+	if !h.retain(t) {
+		h.evictable = append(h.evictable, len(h.entries))
+	}
+	h.entries = append(h.entries, t)
+
+	if h.evicted > len(h.entries)/2 {
+		h.compact()
+	}
+	return nil
+}
+
+// All returns a copy of the recorded transitions, oldest first.
+func (h *MemoryHistory) All() ([]*Transition, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.ordered(), nil
+}
+
+// Retain exempts transitions for which f returns true from eviction. f is
+// called once for each recorded transition and once for each transition
+// appended later.
+func (h *MemoryHistory) Retain(f func(*Transition) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = h.ordered()
+	h.start = 0
+	h.evicted = 0
+	h.evictable = nil
+	h.retain = f
+	if f == nil || h.limit < 1 {
+		return
+	}
+	for i, e := range h.entries {
+		if !f(e) {
+			h.evictable = append(h.evictable, i)
+		}
+	}
+}
+
+// ordered returns a copy of the entries, oldest first.
+func (h *MemoryHistory) ordered() []*Transition {
+	all := make([]*Transition, 0, len(h.entries)-h.evicted)
+	for _, e := range h.entries[h.start:] {
+		if e != nil {
+			all = append(all, e)
+		}
+	}
+	for _, e := range h.entries[:h.start] {
+		if e != nil {
+			all = append(all, e)
+		}
+	}
+	return all
+}
+
+// compact removes the evicted entries, moving the evictable indexes along.
+func (h *MemoryHistory) compact() {
+	entries := make([]*Transition, 0, len(h.entries)-h.evicted)
+	next := 0
+	for i, e := range h.entries {
+		if e == nil {
+			continue
+		}
+		// Evictable indexes are ascending, so the next one to move is the
+		// first not yet moved.
+		if next < len(h.evictable) && h.evictable[next] == i {
+			h.evictable[next] = len(entries)
+			next++
+		}
+		entries = append(entries, e)
+	}
+	h.entries = entries
+	h.evicted = 0
+}
+
+// Clear removes every recorded transition.
+func (h *MemoryHistory) Clear() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = nil
+	h.start = 0
+	h.evictable = nil
+	h.evicted = 0
+	return nil
+}
+
+// EnableHistory records the last max committed transitions in memory, see
+// History. It is a shorthand for WithHistoryStore with a MemoryHistory.
+func (s *StateMachine) EnableHistory(max int) {
+	s.WithHistoryStore(NewMemoryHistory(max))
+}
+
+// History returns the recorded transitions, oldest first. It is empty when no
+// history is kept or the history store fails.
+func (s *StateMachine) History() []HistoryEntry {
+	entries := []HistoryEntry{}
+	store := s.historyStore()
+	if store == nil {
+		return entries
+	}
+
+	all, err := store.All()
+	if err != nil {
+		s.emitError(err)
+		return entries
+	}
+	for _, t := range all {
+		entries = append(entries, HistoryEntry{ID: t.ID, From: t.From.name(), To: t.To.name(), Time: t.Time})
+	}
+	return entries
+}
+
+// WithHistoryStore records every committed transition in the store. Failures to
+// append are sent to the Errors channel. It is safe to call while transitions
+// are made.
+func (s *StateMachine) WithHistoryStore(store HistoryStore) *StateMachine {
+	s.historyMu.Lock()
+	s.history = store
+	retain := s.retainFn
+	s.historyMu.Unlock()
+
+	if r, ok := store.(HistoryRetainer); ok && retain != nil {
+		r.Retain(retain)
+	}
+	return s
+}
+
+// RetainTransition exempts transitions for which f returns true from eviction
+// when the history store trims old entries. It applies to stores implementing
+// HistoryRetainer, such as MemoryHistory.
+func (s *StateMachine) RetainTransition(f func(*Transition) bool) {
+	s.historyMu.Lock()
+	s.retainFn = f
+	store := s.history
+	s.historyMu.Unlock()
+
+	if r, ok := store.(HistoryRetainer); ok {
+		r.Retain(f)
+	}
+}
+
+// historyStore returns the history store, or nil when no history is kept.
+func (s *StateMachine) historyStore() HistoryStore {
+	s.historyMu.RLock()
+	defer s.historyMu.RUnlock()
+	return s.history
+}
+
+// record appends a committed transition to the history store.
+func (s *StateMachine) record(t *Transition) {
+	store := s.historyStore()
+	if store == nil {
+		return
+	}
+
+	if err := store.Append(t); err != nil {
+		s.emitError(err)
+	}
+}
+
+// ClearHistory empties the history store without affecting the current state.
+// Failures are sent to the Errors channel.
+func (s *StateMachine) ClearHistory() {
+	store := s.historyStore()
+	if store == nil {
+		return
+	}
+
+	c, ok := store.(HistoryClearer)
+	if !ok {
+		s.emitError(ErrHistoryNotClearable)
+		return
+	}
+
+	if err := c.Clear(); err != nil {
+		s.emitError(err)
+	}
+}
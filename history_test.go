@@ -0,0 +1,245 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingHistory rejects every append.
+type failingHistory struct{}
+
+func (failingHistory) Append(*Transition) error {
+	return errors.New("store unavailable")
+}
+
+func (failingHistory) All() ([]*Transition, error) {
+	return nil, nil
+}
+
+func TestMemoryHistory(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(2)
+	t1, t2, t3 := &Transition{}, &Transition{}, &Transition{}
+
+	h.Append(t1)
+	h.Append(t2)
+	all, _ := h.All()
+	assert.Equal([]*Transition{t1, t2}, all, "should return transitions oldest first")
+
+	h.Append(t3)
+	all, _ = h.All()
+	assert.Equal([]*Transition{t2, t3}, all, "should drop the oldest transition when full")
+}
+
+func TestWithHistoryStore(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(0)
+	sm := New().WithHistoryStore(h)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.Transition("foo")
+	sm.Transition("foo")
+	sm.Transition("bar")
+
+	all, err := h.All()
+	assert.Nil(err, "should not return an error")
+	assert.Len(all, 2, "should record committed transitions only")
+	assert.Equal("foo", all[0].To.Destination, "should record transitions in order")
+	assert.Equal("bar", all[1].To.Destination, "should record transitions in order")
+}
+
+func TestEnableHistory(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.NewState().FromAny().To("baz")
+	sm.Transition("foo")
+	assert.Equal([]HistoryEntry{}, sm.History(), "should not record history by default")
+
+	sm.EnableHistory(2)
+	begin := time.Now()
+	sm.Transition("bar")
+	sm.Transition("bar")
+	sm.Transition("baz")
+
+	history := sm.History()
+	assert.Len(history, 2, "should keep at most max entries")
+	assert.Equal("foo", history[0].From, "should record the state left")
+	assert.Equal("bar", history[0].To, "should record the state entered")
+	assert.Equal("baz", history[1].To, "should skip same state transitions")
+	assert.False(history[1].Time.Before(begin), "should record the transition time")
+}
+
+func TestEnableHistoryConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			sm.Transition("foo")
+			sm.Transition("bar")
+		}
+		close(done)
+	}()
+
+	sm.EnableHistory(10)
+	sm.RetainTransition(func(*Transition) bool { return false })
+	sm.WithHistoryStore(NewMemoryHistory(10))
+	<-done
+
+	sm.Transition("foo")
+	assert.NotEmpty(sm.History(), "should record transitions made after enabling history")
+}
+
+func TestHistoryStoreError(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithHistoryStore(failingHistory{})
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().To("foo")
+	err := sm.Transition("foo")
+
+	assert.Nil(err, "should not fail the transition")
+	assert.EqualError(<-sm.Errors(), "store unavailable", "should send store errors to the errors channel")
+}
+
+func TestClearHistory(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(2)
+	sm := New().WithHistoryStore(h)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.Transition("foo")
+	sm.Transition("bar")
+	sm.Transition("foo")
+	sm.ClearHistory()
+
+	all, _ := h.All()
+	assert.Empty(all, "should remove recorded transitions")
+	assert.Equal("foo", sm.Name(), "should keep the current state")
+
+	sm.Transition("bar")
+	all, _ = h.All()
+	assert.Len(all, 1, "should keep recording after clearing")
+}
+
+func TestClearHistoryUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithHistoryStore(failingHistory{})
+
+	sm.ClearHistory()
+
+	assert.Equal(ErrHistoryNotClearable, <-sm.Errors(), "should report stores that can not be cleared")
+}
+
+func TestRetainTransition(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(3)
+	sm := New()
+	sm.RetainTransition(func(t *Transition) bool {
+		return t.To.Destination == "approved"
+	})
+	sm.WithHistoryStore(h)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().FromAny().To("approved")
+	sm.NewState().FromAny().To("edited")
+	for _, name := range []string{"draft", "approved", "draft", "edited", "draft", "edited"} {
+		sm.Transition(name)
+	}
+
+	all, _ := h.All()
+	names := []string{}
+	for _, t := range all {
+		names = append(names, t.To.Destination)
+	}
+	assert.Equal([]string{"approved", "draft", "edited"}, names, "should keep retained transitions when trimming")
+}
+
+func TestMemoryHistoryRetainAll(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(1)
+	h.Retain(func(*Transition) bool {
+		return true
+	})
+
+	h.Append(&Transition{})
+	h.Append(&Transition{})
+
+	all, _ := h.All()
+	assert.Len(all, 2, "should grow beyond the limit when everything is retained")
+}
+
+func TestMemoryHistoryRetainIncremental(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(3)
+	calls := 0
+	h.Retain(func(t *Transition) bool {
+		calls++
+		return t.ID%4 == 0
+	})
+
+	for id := uint64(1); id <= 20; id++ {
+		h.Append(&Transition{ID: id})
+	}
+
+	all, _ := h.All()
+	ids := []uint64{}
+	for _, t := range all {
+		ids = append(ids, t.ID)
+	}
+	assert.Equal([]uint64{4, 8, 12, 16, 20}, ids, "should evict the oldest transitions not retained")
+	assert.Equal(20, calls, "should check each transition once")
+}
@@ -0,0 +1,30 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// OnEnterState adds a function to be called whenever the named state is
+// entered, whatever the source. It runs after the default and own enter
+// functions of the state, and not when those fail.
+func (s *StateMachine) OnEnterState(name string, f func(*State)) {
+	if s.enterHooks == nil {
+		s.enterHooks = map[string][]func(*State){}
+	}
+	s.enterHooks[name] = append(s.enterHooks[name], f)
+}
+
+// OnExitState adds a function to be called whenever the named state is left,
+// whatever the destination. It runs after the own exit function of the state.
+func (s *StateMachine) OnExitState(name string, f func(*State)) {
+	if s.exitHooks == nil {
+		s.exitHooks = map[string][]func(*State){}
+	}
+	s.exitHooks[name] = append(s.exitHooks[name], f)
+}
+
+// runHooks calls the functions registered for st in order.
+func (s *StateMachine) runHooks(hooks map[string][]func(*State), st *State) {
+	for _, f := range hooks[st.Destination] {
+		f(st)
+	}
+}
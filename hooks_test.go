@@ -0,0 +1,40 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnEnterState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := []string{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(*State) {
+		calls = append(calls, "own enter")
+	}).OnExit(func(*State) {
+		calls = append(calls, "own exit")
+	})
+	sm.NewState().From("foo").To("bar")
+	sm.OnEnterState("foo", func(st *State) {
+		calls = append(calls, "global enter "+st.Destination)
+	})
+	sm.OnExitState("foo", func(st *State) {
+		calls = append(calls, "global exit "+st.Destination)
+	})
+
+	assert.Nil(sm.TransitionSync("foo"))
+	assert.Equal([]string{"own enter", "global enter foo"}, calls, "should call the global enter function after the own one")
+
+	calls = []string{}
+	assert.Nil(sm.TransitionSync("bar"))
+	assert.Equal([]string{"own exit", "global exit foo"}, calls, "should call the global exit function after the own one")
+}
@@ -0,0 +1,76 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// stateIndex is a precomputed lookup of the state graph.
+type stateIndex struct {
+	// states maps destination names to their definitions.
+	states map[string][]*State
+	// edges maps a source name to the states permitting a change from it.
+	edges map[string]map[*State]bool
+}
+
+// Build precomputes a lookup table of the state graph so that Find and
+// IsValidStateChange no longer scan every state. The table is dropped whenever
+// a state is added or its source or destination changes, call Build again once
+// the definition is complete. Editing States directly requires a rebuild too.
+func (s *StateMachine) Build() *StateMachine {
+	idx := &stateIndex{
+		states: make(map[string][]*State, len(s.definitions())),
+		edges:  make(map[string]map[*State]bool),
+	}
+
+	for _, st := range s.definitions() {
+		idx.states[st.Destination] = append(idx.states[st.Destination], st)
+
+		for _, src := range st.Source {
+			if idx.edges[src] == nil {
+				idx.edges[src] = make(map[*State]bool)
+			}
+			idx.edges[src][st] = true
+		}
+	}
+
+	s.defMu.Lock()
+	s.index = idx
+	s.defMu.Unlock()
+	return s
+}
+
+// lookupIndex returns the index when lookups can use it, or nil.
+func (s *StateMachine) lookupIndex() *stateIndex {
+	if s.compareFn != nil {
+		return nil
+	}
+	s.defMu.RLock()
+	defer s.defMu.RUnlock()
+	return s.index
+}
+
+// definitions returns the defined states. States are only ever appended, so
+// the returned slice can be read while states are added.
+func (s *StateMachine) definitions() []*State {
+	s.defMu.RLock()
+	defer s.defMu.RUnlock()
+	return s.States
+}
+
+// find returns the indexed definitions of a destination name.
+func (idx *stateIndex) find(name string) []*State {
+	return idx.states[name]
+}
+
+// permits reports whether st lists src as one of its sources.
+func (idx *stateIndex) permits(src string, st *State) bool {
+	return idx.edges[src][st.definition()]
+}
+
+// invalidate drops the machines index after the state definition changes.
+func (st *State) invalidate() {
+	if st.machine != nil {
+		st.machine.defMu.Lock()
+		st.machine.index = nil
+		st.machine.defMu.Unlock()
+	}
+}
@@ -0,0 +1,88 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.NewState().From("foo").To("baz")
+	sm.Build()
+
+	assert.NotNil(sm.index, "should build an index")
+
+	st, err := sm.Find("bar")
+	assert.Nil(err, "should find indexed state")
+	assert.Equal("bar", st.Destination, "should return the matching state")
+
+	_, err = sm.Find("qux")
+	assert.EqualError(err, "Invalid state: qux", "should return an error when state does not exist")
+
+	sm.Transition("foo")
+	sm.Transition("bar")
+	err = sm.Transition("baz")
+	assert.EqualError(err, "Invalid state change: bar > baz", "should reject changes missing from the index")
+}
+
+func TestBuildAmbiguous(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("baz").To("foo")
+
+	sm.NewState().FromAny().To("bar")
+	sm.NewState().FromAny().To("baz")
+	sm.NewState().FromAny().To("qux")
+	sm.NewState().From("qux").To("foo")
+	sm.NewState().From("qux").To("foo")
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	for _, build := range []bool{false, true} {
+		if build {
+			sm.Build()
+		}
+		sm.Transition("bar")
+		assert.Nil(sm.Transition("foo"), "should use the definition permitting the current state")
+		sm.Transition("baz")
+		assert.Nil(sm.Transition("foo"), "should use the definition permitting the current state")
+
+		sm.Transition("qux")
+		err := sm.Transition("foo")
+		assert.True(errors.Is(err, ErrAmbiguousState), "should reject changes more than one definition permits")
+		assert.EqualError(err, "Ambiguous state: qux > foo", "should name the states")
+	}
+}
+
+func TestBuildInvalidate(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	st := sm.NewState().To("foo")
+	sm.Build()
+
+	sm.NewState().To("bar")
+	assert.Nil(sm.index, "should drop the index when a state is added")
+
+	sm.Build()
+	st.From("bar")
+	assert.Nil(sm.index, "should drop the index when a state changes")
+}
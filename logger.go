@@ -0,0 +1,40 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// Logger receives the decisions made by the machine. Debugf is used for
+// routine steps such as requested transitions and handler invocations, Infof
+// for rejections, failures and cancellations.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+}
+
+// nopLogger discards everything, it is used while no logger is set.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+
+// WithLogger sets the logger receiving the decisions made by the machine.
+func (s *StateMachine) WithLogger(l Logger) *StateMachine {
+	s.logger = l
+	return s
+}
+
+// log returns the logger of the machine, or one discarding everything.
+func (s *StateMachine) log() Logger {
+	if s == nil || s.logger == nil {
+		return nopLogger{}
+	}
+	return s.logger
+}
+
+// names returns the source and destination names of the transition.
+func (t *Transition) names() (from, to string) {
+	if t.From != nil {
+		from = t.From.Destination
+	}
+	return from, t.To.Destination
+}
@@ -0,0 +1,66 @@
+package fsm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, "debug: "+fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Infof(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, "info: "+fmt.Sprintf(format, args...))
+}
+
+func TestWithLogger(t *testing.T) {
+	assert := assert.New(t)
+	logger := &testLogger{}
+	sm := New().WithLogger(logger)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Guard(func(from, to *State) bool {
+		return false
+	})
+
+	assert.Nil(sm.TransitionSync("foo"))
+	err := sm.Transition("bar")
+	assert.NotNil(err)
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	for _, line := range []string{
+		"debug: Transition requested:  > foo",
+		"debug: Transition committed:  > foo (#1)",
+		"debug: Entering state: foo (#1)",
+		"debug: Transition requested: foo > bar",
+		"info: Transition rejected: foo > bar: " + err.Error(),
+	} {
+		assert.Contains(logger.lines, line, "should log every decision")
+	}
+}
+
+func TestNopLogger(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	assert.Equal(nopLogger{}, sm.log(), "should discard logs by default")
+}
@@ -0,0 +1,185 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"sync"
+	"time"
+)
+
+// OnStateExit sets a function to be called whenever the machine leaves a state,
+// with the time spent in it. The start state is reported as StartName. Stop
+// ends the time spent in the current state as well.
+func (s *StateMachine) OnStateExit(f func(name string, duration time.Duration)) {
+	s.stateExitFn = f
+}
+
+// OnStateDuration sets a function to be called like the one set by
+// OnStateExit. Both are called when set.
+func (s *StateMachine) OnStateDuration(f func(state string, d time.Duration)) {
+	s.stateDurationFn = f
+}
+
+// entered records the time the current state was entered, reporting the time
+// spent in the state being left.
+func (s *StateMachine) entered(left *State) {
+	now := time.Now()
+	s.clockMu.Lock()
+	since := s.enteredAt
+	s.enteredAt = now
+	s.clockMu.Unlock()
+
+	if left == nil {
+		return
+	}
+	if s.stateExitFn != nil {
+		s.stateExitFn(s.stateName(left), now.Sub(since))
+	}
+	if s.stateDurationFn != nil {
+		s.stateDurationFn(s.stateName(left), now.Sub(since))
+	}
+}
+
+// TransitionKey identifies the transitions between two states.
+type TransitionKey struct {
+	From string
+	To   string
+}
+
+// counted increments the number of transitions from left to st.
+func (s *StateMachine) counted(left, st *State) {
+	key := TransitionKey{To: st.Destination}
+	if left != nil {
+		key.From = s.stateName(left)
+	}
+
+	s.countsMu.Lock()
+	if s.counts == nil {
+		s.counts = map[TransitionKey]int{}
+	}
+	s.counts[key]++
+	s.countsMu.Unlock()
+}
+
+// TransitionCounter returns a copy of the number of committed transitions
+// per source and destination. The start state is reported as StartName, and
+// the first state entered without one has an empty source.
+func (s *StateMachine) TransitionCounter() map[TransitionKey]int {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+
+	counts := make(map[TransitionKey]int, len(s.counts))
+	for k, v := range s.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// stateName returns the name of a state, using StartName for the start state.
+func (s *StateMachine) stateName(st *State) string {
+	if st != nil && st == s.start {
+		return StartName
+	}
+	return st.name()
+}
+
+// LatencyStat aggregates the durations of a measured operation.
+type LatencyStat struct {
+	Count int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average duration.
+func (l LatencyStat) Mean() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+func (l *LatencyStat) add(d time.Duration) {
+	l.Count++
+	l.Total += d
+	if d > l.Max {
+		l.Max = d
+	}
+}
+
+// GuardKey identifies a guard evaluated for a transition between two states.
+type GuardKey struct {
+	From  string
+	To    string
+	Index int
+}
+
+// LatencyStats holds the time spent in guards, per edge and guard, and in
+// enter handlers, per state.
+type LatencyStats struct {
+	Guards   map[GuardKey]LatencyStat
+	Handlers map[string]LatencyStat
+}
+
+// latencyTracker records latencies while enabled.
+type latencyTracker struct {
+	mu    sync.Mutex
+	stats LatencyStats
+}
+
+// WithLatencyStats enables timing of guards and enter handlers.
+func (s *StateMachine) WithLatencyStats() *StateMachine {
+	s.latency = &latencyTracker{stats: LatencyStats{
+		Guards:   map[GuardKey]LatencyStat{},
+		Handlers: map[string]LatencyStat{},
+	}}
+	return s
+}
+
+// LatencyStats returns a copy of the recorded latencies, which are empty
+// unless WithLatencyStats was used.
+func (s *StateMachine) LatencyStats() LatencyStats {
+	stats := LatencyStats{
+		Guards:   map[GuardKey]LatencyStat{},
+		Handlers: map[string]LatencyStat{},
+	}
+	if s.latency == nil {
+		return stats
+	}
+
+	s.latency.mu.Lock()
+	defer s.latency.mu.Unlock()
+	for k, v := range s.latency.stats.Guards {
+		stats.Guards[k] = v
+	}
+	for k, v := range s.latency.stats.Handlers {
+		stats.Handlers[k] = v
+	}
+	return stats
+}
+
+// guardTimed records the duration of a guard evaluation.
+func (s *StateMachine) guardTimed(key GuardKey, d time.Duration) {
+	if s.latency == nil {
+		return
+	}
+
+	s.latency.mu.Lock()
+	stat := s.latency.stats.Guards[key]
+	stat.add(d)
+	s.latency.stats.Guards[key] = stat
+	s.latency.mu.Unlock()
+}
+
+// handlerTimed records the duration of an enter handler.
+func (s *StateMachine) handlerTimed(name string, d time.Duration) {
+	if s.latency == nil {
+		return
+	}
+
+	s.latency.mu.Lock()
+	stat := s.latency.stats.Handlers[name]
+	stat.add(d)
+	s.latency.stats.Handlers[name] = stat
+	s.latency.mu.Unlock()
+}
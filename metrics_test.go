@@ -0,0 +1,137 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnStateExit(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	names := []string{}
+	durations := []time.Duration{}
+
+	sm.OnStart(func(*State) {})
+	sm.NewState().FromStart().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.OnStateExit(func(name string, d time.Duration) {
+		names = append(names, name)
+		durations = append(durations, d)
+	})
+
+	sm.Start()
+	sm.Transition("foo")
+	time.Sleep(5 * time.Millisecond)
+	sm.Transition("bar")
+
+	assert.Equal([]string{StartName, "foo"}, names, "should report every state left")
+	assert.True(durations[1] >= 5*time.Millisecond, "should report the time spent in the state")
+}
+
+func TestOnStateDuration(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	names := []string{}
+
+	sm.NewState().FromAny().To("foo")
+	sm.OnStateDuration(func(state string, d time.Duration) {
+		names = append(names, state)
+	})
+
+	sm.Transition("foo")
+	assert.Equal([]string{}, names, "should not report the state entered")
+	sm.Stop()
+	assert.Equal([]string{"foo"}, names, "should report the current state on stop")
+}
+
+func TestOnStateDurationWithExit(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	exits := []string{}
+	durations := []string{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.OnStateExit(func(name string, d time.Duration) {
+		exits = append(exits, name)
+	})
+	sm.OnStateDuration(func(state string, d time.Duration) {
+		durations = append(durations, state)
+	})
+
+	sm.Transition("foo")
+	sm.Transition("bar")
+	assert.Equal([]string{"foo"}, exits, "should keep the OnStateExit function")
+	assert.Equal([]string{"foo"}, durations, "should call the OnStateDuration function")
+}
+
+func TestTransitionCounter(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+
+	sm.OnStart(func(*State) {})
+	sm.NewState().FromStart().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+
+	assert.Equal(map[TransitionKey]int{}, sm.TransitionCounter(), "should be empty without transitions")
+
+	sm.Start()
+	sm.Transition("foo")
+	sm.Transition("bar")
+	sm.Transition("foo")
+	sm.Transition("bar")
+
+	assert.Equal(map[TransitionKey]int{
+		{From: StartName, To: "foo"}: 1,
+		{From: "foo", To: "bar"}:     2,
+		{From: "bar", To: "foo"}:     1,
+	}, sm.TransitionCounter(), "should count transitions per edge")
+}
+
+func TestLatencyStats(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithLatencyStats()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(*State) {
+		time.Sleep(2 * time.Millisecond)
+	})
+	sm.NewState().From("foo").To("bar").GuardWith(GuardFunc(func(from, to *State) bool {
+		time.Sleep(3 * time.Millisecond)
+		return true
+	}))
+
+	sm.Transition("foo")
+	sm.ProcessNext()
+	sm.Transition("bar")
+	sm.ProcessNext()
+
+	stats := sm.LatencyStats()
+	guard := stats.Guards[GuardKey{From: "foo", To: "bar", Index: 0}]
+	assert.Equal(1, guard.Count, "should count guard evaluations per edge")
+	assert.True(guard.Max >= 3*time.Millisecond, "should record guard time")
+
+	handler := stats.Handlers["foo"]
+	assert.Equal(1, handler.Count, "should count handler runs per state")
+	assert.True(handler.Mean() >= 2*time.Millisecond, "should record handler time")
+}
+
+func TestLatencyStatsDisabled(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().To("foo")
+
+	sm.Transition("foo")
+	sm.ProcessNext()
+
+	assert.Empty(sm.LatencyStats().Handlers, "should not record unless enabled")
+}
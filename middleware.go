@@ -0,0 +1,27 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// TransitionFunc performs a transition to the named state.
+type TransitionFunc func(to string) error
+
+// Middleware wraps the transition of a machine. A middleware can inspect or
+// change the requested state before calling next, or return without calling
+// next to short-circuit the transition, in which case the state and history
+// are left unchanged and its result is returned to the caller.
+type Middleware func(next TransitionFunc) TransitionFunc
+
+// Use adds middleware around every transition. The first middleware added is
+// the outermost one.
+func (s *StateMachine) Use(mw ...Middleware) {
+	s.middleware = append(s.middleware, mw...)
+}
+
+// wrap applies the middleware to a transition function.
+func (s *StateMachine) wrap(next TransitionFunc) TransitionFunc {
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		next = s.middleware[i](next)
+	}
+	return next
+}
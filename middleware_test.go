@@ -0,0 +1,71 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUse(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := []string{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.Use(func(next TransitionFunc) TransitionFunc {
+		return func(to string) error {
+			calls = append(calls, "outer:"+to)
+			return next(to)
+		}
+	}, func(next TransitionFunc) TransitionFunc {
+		return func(to string) error {
+			calls = append(calls, "inner:"+to)
+			return next(to)
+		}
+	})
+
+	assert.Nil(sm.Transition("foo"), "should not return an error")
+	assert.Equal([]string{"outer:foo", "inner:foo"}, calls, "should run middleware in order")
+	assert.Equal("foo", sm.Name(), "should change state")
+}
+
+func TestUseShortCircuit(t *testing.T) {
+	assert := assert.New(t)
+	h := NewMemoryHistory(0)
+	sm := New().WithHistoryStore(h)
+	done := map[string]bool{"bar": true}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.Transition("foo")
+
+	// Idempotency middleware returning a cached success.
+	sm.Use(func(next TransitionFunc) TransitionFunc {
+		return func(to string) error {
+			if done[to] {
+				return nil
+			}
+			return next(to)
+		}
+	})
+
+	assert.Nil(sm.Transition("bar"), "should return the cached result")
+	assert.Equal("foo", sm.Name(), "should not change state")
+
+	all, _ := h.All()
+	assert.Len(all, 1, "should not record short-circuited transitions")
+}
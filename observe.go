@@ -0,0 +1,147 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "context"
+
+// observer receives every executed transition, or every committed one when
+// committed is set.
+type observer struct {
+	fn        func(*Transition)
+	committed bool
+}
+
+// observe registers f to be called after every executed transition and
+// returns a function removing it again.
+func (s *StateMachine) observe(f func(*Transition)) func() {
+	return s.addObserver(&observer{fn: f})
+}
+
+// observeCommitted registers f to be called after every committed transition,
+// once the current state has changed.
+func (s *StateMachine) observeCommitted(f func(*Transition)) func() {
+	return s.addObserver(&observer{fn: f, committed: true})
+}
+
+// addObserver registers o and returns a function removing it again.
+func (s *StateMachine) addObserver(o *observer) func() {
+
+	s.observersMu.Lock()
+	s.observers = append(s.observers, o)
+	s.observersMu.Unlock()
+
+	return func() {
+		s.observersMu.Lock()
+		defer s.observersMu.Unlock()
+		for i, existing := range s.observers {
+			if existing == o {
+				s.observers = append(s.observers[:i:i], s.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify passes an executed transition to the observers.
+func (s *StateMachine) notify(t *Transition) {
+	s.notifyObservers(t, false)
+}
+
+// notifyObservers passes a transition to the observers of the given kind.
+func (s *StateMachine) notifyObservers(t *Transition, committed bool) {
+	s.observersMu.Lock()
+	observers := s.observers
+	s.observersMu.Unlock()
+
+	for _, o := range observers {
+		if o.committed == committed {
+			o.fn(t)
+		}
+	}
+}
+
+// StreamTo forwards every executed transition to ch until ctx is done. The
+// channel is never closed by the machine. Sends block the transition executor,
+// so ch should be buffered or drained promptly.
+func (s *StateMachine) StreamTo(ctx context.Context, ch chan<- *Transition) {
+	s.WithScopedHook(ctx, func(t *Transition) {
+		select {
+		case <-ctx.Done():
+		case ch <- t:
+		}
+	})
+}
+
+// WithScopedHook calls f after every executed transition until ctx is done, at
+// which point the hook is removed.
+func (s *StateMachine) WithScopedHook(ctx context.Context, f func(*Transition)) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	remove := s.observe(func(t *Transition) {
+		if ctx.Err() == nil {
+			f(t)
+		}
+	})
+
+	go func() {
+		<-ctx.Done()
+		remove()
+	}()
+}
+
+// Wait blocks until a final state has been entered or ctx is done. It returns
+// nil straight away when the current state is already final.
+func (s *StateMachine) Wait(ctx context.Context) error {
+	finished := make(chan struct{}, 1)
+	// Committed transitions are observed, as executing one may complete before
+	// the current state changes.
+	remove := s.observeCommitted(func(t *Transition) {
+		if t.To.final {
+			select {
+			case finished <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer remove()
+
+	if s.IsFinished() {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-finished:
+		return nil
+	}
+}
+
+// WaitFor blocks until the named state has been entered or ctx is done. It
+// returns nil straight away when the machine is already in the state.
+func (s *StateMachine) WaitFor(ctx context.Context, state string) error {
+	reached := make(chan struct{}, 1)
+	remove := s.observeCommitted(func(t *Transition) {
+		if s.equal(t.To.Destination, state) {
+			select {
+			case reached <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer remove()
+
+	if s.Match(state) {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-reached:
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamTo(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *Transition, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.StreamTo(ctx, ch)
+
+	sm.Transition("foo")
+	tr := <-ch
+	assert.Equal("foo", tr.To.Destination, "should forward executed transitions")
+
+	cancel()
+	assert.Eventually(func() bool {
+		sm.observersMu.Lock()
+		defer sm.observersMu.Unlock()
+		return len(sm.observers) == 0
+	}, time.Second, time.Millisecond, "should stop forwarding once the context is done")
+}
+
+func TestWait(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Final()
+	sm.Transition("foo")
+	assert.False(sm.IsFinished(), "should not be finished in a regular state")
+
+	done := make(chan error)
+	go func() {
+		done <- sm.Wait(context.Background())
+	}()
+
+	sm.Transition("bar")
+	assert.Nil(<-done, "should return once a final state is entered")
+	assert.True(sm.IsFinished(), "should be finished in a final state")
+	assert.Nil(sm.Wait(context.Background()), "should return immediately when finished")
+}
+
+func TestWaitCancelled(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := sm.Wait(ctx)
+
+	assert.EqualError(err, "context deadline exceeded", "should return the context error")
+}
+
+func TestWithScopedHook(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := make(chan string, 2)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.WithScopedHook(ctx, func(t *Transition) {
+		seen <- t.To.Destination
+	})
+
+	sm.Transition("foo")
+	assert.Equal("foo", <-seen, "should call the hook while the context is live")
+
+	cancel()
+	sm.Transition("bar")
+	assert.Eventually(func() bool {
+		sm.observersMu.Lock()
+		defer sm.observersMu.Unlock()
+		return len(sm.observers) == 0
+	}, time.Second, time.Millisecond, "should remove the hook once the context is done")
+	assert.Len(seen, 0, "should not call the hook after the context is done")
+}
+
+func TestWaitFor(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar")
+	sm.Transition("foo")
+
+	done := make(chan error)
+	go func() {
+		done <- sm.WaitFor(context.Background(), "bar")
+	}()
+
+	sm.Transition("bar")
+	assert.Nil(<-done, "should return once the state is entered")
+	assert.Nil(sm.WaitFor(context.Background(), "bar"), "should return immediately when in the state")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, sm.WaitFor(ctx, "foo"), "should return the context error")
+
+	sm.observersMu.Lock()
+	defer sm.observersMu.Unlock()
+	assert.Len(sm.observers, 0, "should remove the observer on return")
+}
@@ -0,0 +1,44 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "context"
+
+// Option configures a StateMachine created by New.
+type Option func(*StateMachine)
+
+// WithContextOption sets the machine context, see StateMachine.WithContext.
+func WithContextOption(ctx context.Context) Option {
+	return func(s *StateMachine) {
+		s.WithContext(ctx)
+	}
+}
+
+// WithBuffer sets the size of the transitions channel, see NewWithBuffer.
+func WithBuffer(size int) Option {
+	return func(s *StateMachine) {
+		s.transitions = newTransitions(size)
+	}
+}
+
+// WithBefore sets the action called before a transition is executed.
+func WithBefore(f func(*Transition)) Option {
+	return func(s *StateMachine) {
+		s.BeforeTransition(f)
+	}
+}
+
+// WithAfter sets the action called after a transition is executed.
+func WithAfter(f func(*Transition)) Option {
+	return func(s *StateMachine) {
+		s.AfterTransition(f)
+	}
+}
+
+// WithHistory records the last max committed transitions, see EnableHistory.
+func WithHistory(max int) Option {
+	return func(s *StateMachine) {
+		s.EnableHistory(max)
+	}
+}
@@ -0,0 +1,30 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOptions(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	calls := []string{}
+
+	sm := New(
+		WithContextOption(ctx),
+		WithBuffer(4),
+		WithBefore(func(*Transition) { calls = append(calls, "before") }),
+		WithAfter(func(*Transition) { calls = append(calls, "after") }),
+		WithHistory(10),
+	)
+	sm.NewState().FromAny().To("foo")
+	sm.Transition("foo")
+	sm.ProcessNext()
+
+	assert.NotNil(sm.ctx, "should set the context")
+	assert.Equal(4, cap(sm.transitions), "should set the buffer size")
+	assert.Equal([]string{"before", "after"}, calls, "should set the before and after actions")
+	assert.Len(sm.History(), 1, "should enable history")
+}
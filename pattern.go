@@ -0,0 +1,79 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "path"
+
+// ToPattern makes the state stand for a family of states whose names match the
+// pattern, using path.Match syntax such as "worker:*". Transitioning to a name
+// without an exact definition enters a copy of the first matching pattern state
+// named after the concrete name, so its handlers see that name as Destination.
+//
+// The source rules of the pattern state apply to every member. Leaving a member
+// is permitted by states listing either its concrete name or the pattern as a
+// source.
+func (st *State) ToPattern(pattern string) *State {
+	st.Destination = pattern
+	st.isPattern = true
+	st.invalidate()
+	return st
+}
+
+// FromPattern allows the state to be transitioned to from every state whose
+// name matches the pattern, using path.Match syntax such as "review_*" or
+// "step?". Patterns add to the sources set by From. Like those, they do not
+// match the start state, which requires FromStart, and they are overruled by
+// ExceptFrom. FromAny makes them redundant.
+func (st *State) FromPattern(glob string) *State {
+	st.sourcePatterns = append(st.sourcePatterns, glob)
+	st.invalidate()
+	return st
+}
+
+// matchesSourcePattern returns true when name matches a pattern set by
+// FromPattern. Malformed patterns match nothing.
+func (st *State) matchesSourcePattern(name string) bool {
+	for _, glob := range st.sourcePatterns {
+		if ok, err := path.Match(glob, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Pattern returns the pattern a state was matched by, or an empty string for
+// states that are not a member of a pattern family.
+func (st *State) Pattern() string {
+	if st.pattern == nil {
+		return ""
+	}
+	return st.pattern.Destination
+}
+
+// definition returns the defined state a state was created from.
+func (st *State) definition() *State {
+	if st.pattern != nil {
+		return st.pattern
+	}
+	return st
+}
+
+// findPattern returns a member of the first pattern state matching name.
+func (s *StateMachine) findPattern(name string) *State {
+	for _, st := range s.definitions() {
+		if !st.isPattern {
+			continue
+		}
+		if ok, _ := path.Match(st.Destination, name); ok {
+			// Members share the flags of the pattern state.
+			member := *st
+			member.Destination = name
+			member.isPattern = false
+			member.pattern = st
+			member.ctx, member.cancel = nil, nil
+			return &member
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToPattern(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := make(chan string, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("idle")
+	sm.NewState().From("idle", "worker:*").ToPattern("worker:*").OnEnter(func(st *State) {
+		entered <- st.Destination
+	})
+	sm.NewState().From("worker:*").To("done")
+	sm.Transition("idle")
+
+	assert.Nil(sm.Transition("worker:3"), "should transition to a pattern member")
+	assert.Equal("worker:3", <-entered, "should pass the concrete name to the handler")
+	assert.Equal("worker:3", sm.Name(), "should report the concrete name")
+	assert.Equal("worker:*", sm.CurrentState.Pattern(), "should report the matched pattern")
+
+	assert.Nil(sm.Transition("worker:4"), "should apply source rules using the pattern name")
+	assert.Equal("worker:4", <-entered, "should enter the new member")
+
+	assert.EqualError(sm.Transition("shard:1"), "Invalid state: shard:1", "should reject names matching no pattern")
+	assert.Nil(sm.Transition("done"), "should leave members through the pattern name")
+}
+
+func TestToPatternExclusive(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := make(chan bool)
+	finish := make(chan bool)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("idle")
+	sm.NewState().From("idle").ToPattern("w:*").Parallel(true).Exclusive().OnEnter(func(*State) {
+		entered <- true
+		<-finish
+	})
+	sm.Transition("idle")
+
+	sm.Transition("w:1")
+	<-entered
+	sm.Transition("idle")
+
+	err := sm.Transition("w:1")
+	assert.True(errors.Is(err, ErrStateBusy), "should reject entering a busy pattern member")
+
+	finish <- true
+	assert.Eventually(func() bool {
+		return sm.Transition("w:1") == nil
+	}, time.Second, 10*time.Millisecond, "should allow entering once the handler completes")
+	<-entered
+	finish <- true
+}
+
+func TestToPatternExactWins(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().ToPattern("worker:*")
+	exact := sm.NewState().To("worker:main")
+
+	st, err := sm.Find("worker:main")
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal(exact, st, "should prefer exact definitions over patterns")
+}
+
+func TestToPatternIndexed(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().ToPattern("worker:*")
+	sm.NewState().From("worker:*").To("done")
+	sm.Build()
+
+	sm.CurrentState, _ = sm.Find("worker:1")
+
+	assert.Nil(sm.ExplainTransition("done"), "should leave members through the pattern name when indexed")
+}
+
+func TestFromPattern(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("review_legal")
+	sm.NewState().FromAny().To("review_tech")
+	sm.NewState().FromAny().To("draft")
+	sm.NewState().FromAny().To("step1")
+	sm.NewState().FromAny().To("step10")
+	sm.NewState().FromPattern("review_*").To("approved")
+	sm.NewState().FromPattern("step?").From("draft").To("done")
+
+	for _, from := range []string{"review_legal", "review_tech"} {
+		assert.Nil(sm.TransitionSync(from))
+		assert.True(sm.Can("approved"), "should match sources by prefix")
+	}
+	assert.Nil(sm.TransitionSync("draft"))
+	assert.False(sm.Can("approved"), "should reject sources not matching the pattern")
+	assert.True(sm.Can("done"), "should keep explicit sources")
+
+	assert.Nil(sm.TransitionSync("step1"))
+	assert.True(sm.Can("done"), "should match single characters")
+	assert.Nil(sm.TransitionSync("step10"))
+	assert.False(sm.Can("done"), "should match exactly one character")
+
+	sm.Build()
+	assert.Nil(sm.TransitionSync("review_tech"))
+	assert.True(sm.Can("approved"), "should match patterns with the index")
+}
+
+func TestFromPatternMalformed(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromPattern("review_[").To("approved")
+
+	assert.Equal([]error{fmt.Errorf("Malformed source pattern: review_[ > approved")}, sm.Validate(), "should report malformed patterns")
+}
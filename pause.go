@@ -0,0 +1,105 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "sync"
+
+// pauser holds transition execution while the machine is paused.
+type pauser struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	paused      bool
+	steps       int
+	breakpoints map[string]bool
+	onBreak     func(*Transition)
+}
+
+func newPauser() *pauser {
+	p := &pauser{breakpoints: map[string]bool{}}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Pause holds transitions before their states are entered until Resume or Step
+// is called. Transitions are still validated and committed while paused.
+func (s *StateMachine) Pause() {
+	s.pauser.mu.Lock()
+	s.pauser.paused = true
+	s.pauser.mu.Unlock()
+	s.emit(Event{Kind: Paused, State: s.Name()})
+}
+
+// Resume continues executing transitions after Pause or a breakpoint.
+func (s *StateMachine) Resume() {
+	s.pauser.mu.Lock()
+	s.pauser.paused = false
+	s.pauser.steps = 0
+	s.pauser.mu.Unlock()
+	s.pauser.cond.Broadcast()
+	s.emit(Event{Kind: Resumed, State: s.Name()})
+}
+
+// Step executes a single held transition and stays paused.
+func (s *StateMachine) Step() {
+	s.pauser.mu.Lock()
+	if s.pauser.paused {
+		s.pauser.steps++
+	}
+	s.pauser.mu.Unlock()
+	s.pauser.cond.Broadcast()
+}
+
+// Paused returns true when transition execution is being held.
+func (s *StateMachine) Paused() bool {
+	s.pauser.mu.Lock()
+	defer s.pauser.mu.Unlock()
+	return s.pauser.paused
+}
+
+// Breakpoint pauses the machine when it is about to enter the named state.
+func (s *StateMachine) Breakpoint(name string) {
+	s.pauser.mu.Lock()
+	s.pauser.breakpoints[name] = true
+	s.pauser.mu.Unlock()
+}
+
+// ClearBreakpoint removes a breakpoint set by Breakpoint.
+func (s *StateMachine) ClearBreakpoint(name string) {
+	s.pauser.mu.Lock()
+	delete(s.pauser.breakpoints, name)
+	s.pauser.mu.Unlock()
+}
+
+// OnBreakpoint sets a function to be called when a breakpoint pauses the machine.
+func (s *StateMachine) OnBreakpoint(f func(*Transition)) {
+	s.pauser.mu.Lock()
+	s.pauser.onBreak = f
+	s.pauser.mu.Unlock()
+}
+
+// wait blocks while the machine is paused, pausing it first when the
+// transition hits a breakpoint.
+func (s *StateMachine) wait(t *Transition) {
+	p := s.pauser
+	p.mu.Lock()
+
+	if p.breakpoints[t.To.Destination] && !p.paused {
+		p.paused = true
+		f := p.onBreak
+		p.mu.Unlock()
+		s.emit(Event{Kind: Paused, State: t.To.Destination, Transition: t})
+		if f != nil {
+			f(t)
+		}
+		p.mu.Lock()
+	}
+
+	for p.paused && p.steps == 0 {
+		p.cond.Wait()
+	}
+	if p.paused {
+		p.steps--
+	}
+	p.mu.Unlock()
+}
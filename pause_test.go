@@ -0,0 +1,81 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakpoint(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := make(chan string, 2)
+	hit := make(chan string, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(st *State) {
+		entered <- st.Destination
+	})
+	sm.NewState().From("foo").To("bar").OnEnter(func(st *State) {
+		entered <- st.Destination
+	})
+	sm.Breakpoint("bar")
+	sm.OnBreakpoint(func(t *Transition) {
+		hit <- t.To.Destination
+	})
+
+	sm.Transition("foo")
+	assert.Equal("foo", <-entered, "should enter states without breakpoints")
+
+	sm.Transition("bar")
+	assert.Equal("bar", <-hit, "should notify when the breakpoint is hit")
+	assert.True(sm.Paused(), "should pause on the breakpoint")
+	select {
+	case <-entered:
+		assert.Fail("should not enter the state while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	sm.Step()
+	assert.Equal("bar", <-entered, "should enter the state on step")
+	assert.True(sm.Paused(), "should stay paused after a step")
+
+	sm.ClearBreakpoint("bar")
+	sm.Resume()
+	assert.False(sm.Paused(), "should resume")
+}
+
+func TestPauseResume(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := make(chan string, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(st *State) {
+		entered <- st.Destination
+	})
+	sm.Pause()
+	sm.Transition("foo")
+
+	select {
+	case <-entered:
+		assert.Fail("should not enter the state while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	sm.Resume()
+	assert.Equal("foo", <-entered, "should enter the state once resumed")
+}
@@ -0,0 +1,76 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "context"
+
+// payloadKey is the context key of transition payloads.
+type payloadKey struct{}
+
+// ContextWithPayload returns a copy of ctx carrying v as the transition payload.
+func ContextWithPayload(ctx context.Context, v interface{}) context.Context {
+	return context.WithValue(ctx, payloadKey{}, v)
+}
+
+// PayloadFromContext returns the payload stored by ContextWithPayload when it
+// has the type T.
+func PayloadFromContext[T any](ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(payloadKey{}).(T)
+	return v, ok
+}
+
+// valueContext looks values up in vals ahead of the embedded context, which
+// remains responsible for cancellation.
+type valueContext struct {
+	context.Context
+	vals context.Context
+}
+
+func (c valueContext) Value(key interface{}) interface{} {
+	if v := c.vals.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// TransitionWith changes the state when permissible, passing data along. It is
+// available as the Transition Data, and through TransitionData of the inbound
+// state to its OnEnter and later OnExit functions.
+func (s *StateMachine) TransitionWith(to string, data interface{}) error {
+	return s.transition(transitionRequest{to: to, data: data})
+}
+
+// TransitionData returns the data passed to TransitionWith by the transition
+// that entered the state.
+func (st *State) TransitionData() interface{} {
+	return st.data
+}
+
+// TransitionCtx changes the state when permissible, making the values of ctx,
+// such as a payload from ContextWithPayload, available through the inbound
+// states Context. Cancellation of the state context still follows the machine.
+func (s *StateMachine) TransitionCtx(ctx context.Context, to string) error {
+	return s.transition(transitionRequest{to: to, ctx: ctx})
+}
+
+// TransitionWithContext works like TransitionCtx, but the inbound state context
+// is cancelled when either ctx or the machine context is done, so callers can
+// bound the state by a request deadline.
+func (s *StateMachine) TransitionWithContext(ctx context.Context, to string) error {
+	return s.transition(transitionRequest{to: to, ctx: ctx, linked: true})
+}
+
+// linkCancel calls cancel once parent is done, unless ctx is done first.
+func linkCancel(parent, ctx context.Context, cancel context.CancelFunc) {
+	if parent.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-parent.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+}
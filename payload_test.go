@@ -0,0 +1,112 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadFromContext(t *testing.T) {
+	assert := assert.New(t)
+	ctx := ContextWithPayload(context.Background(), 42)
+
+	v, ok := PayloadFromContext[int](ctx)
+	assert.True(ok, "should find the payload")
+	assert.Equal(42, v, "should return the payload")
+
+	_, ok = PayloadFromContext[string](ctx)
+	assert.False(ok, "should not match a payload of another type")
+
+	_, ok = PayloadFromContext[int](context.Background())
+	assert.False(ok, "should not find a missing payload")
+}
+
+func TestTransitionCtx(t *testing.T) {
+	assert := assert.New(t)
+	machineCtx, cancel := context.WithCancel(context.Background())
+	sm := New().WithContext(machineCtx)
+	payload := make(chan int, 1)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	st := sm.NewState().To("foo").OnEnter(func(st *State) {
+		v, _ := PayloadFromContext[int](st.Context())
+		payload <- v
+	})
+
+	err := sm.TransitionCtx(ContextWithPayload(context.Background(), 7), "foo")
+	assert.Nil(err, "should not return an error")
+	assert.Equal(7, <-payload, "should expose the payload to the handler")
+
+	cancel()
+	assert.Eventually(func() bool {
+		return st.Context().Err() != nil
+	}, time.Second, time.Millisecond, "should cancel the state with the machine")
+}
+
+func TestTransitionWith(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := make(chan interface{}, 1)
+	exited := make(chan interface{}, 1)
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(st *State) {
+		entered <- st.TransitionData()
+	}).OnExit(func(st *State) {
+		exited <- st.TransitionData()
+	})
+	sm.NewState().From("foo").To("bar")
+
+	err := sm.TransitionWith("foo", "request")
+	assert.Nil(err, "should not return an error")
+
+	tr := <-sm.Transitions()
+	assert.Equal("request", tr.Data, "should set the transition data")
+	tr.Do()
+	assert.Equal("request", <-entered, "should expose the data to the enter function")
+
+	sm.Transition("bar")
+	tr = <-sm.Transitions()
+	assert.Nil(tr.Data, "should have no data when transitioning without")
+	tr.Do()
+	assert.Equal("request", <-exited, "should expose the data to the exit function")
+}
+
+func TestTransitionWithContext(t *testing.T) {
+	assert := assert.New(t)
+	machineCtx, cancelMachine := context.WithCancel(context.Background())
+	sm := New().WithContext(machineCtx)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	foo := sm.NewState().FromAny().To("foo")
+	bar := sm.NewState().FromAny().To("bar")
+
+	ctx, cancel := context.WithCancel(ContextWithPayload(context.Background(), 7))
+	assert.Nil(sm.TransitionWithContext(ctx, "foo"))
+	v, _ := PayloadFromContext[int](foo.Context())
+	assert.Equal(7, v, "should expose the values of the context")
+
+	cancel()
+	assert.Eventually(func() bool {
+		return foo.Context().Err() != nil
+	}, time.Second, 10*time.Millisecond, "should cancel the state with the passed context")
+
+	assert.Nil(sm.TransitionWithContext(context.Background(), "bar"))
+	cancelMachine()
+	assert.Eventually(func() bool {
+		return bar.Context().Err() != nil
+	}, time.Second, 10*time.Millisecond, "should cancel the state with the machine")
+}
@@ -0,0 +1,124 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// TransitionOption describes a candidate transition from the current state.
+type TransitionOption struct {
+	Name    string
+	Allowed bool
+	// Reason explains why the transition is not allowed.
+	Reason error
+}
+
+// IsKnownState returns true when name is a defined state. It allows telling
+// unknown names apart from known states that can not be transitioned to.
+func (s *StateMachine) IsKnownState(name string) bool {
+	_, err := s.Find(name)
+	return err == nil
+}
+
+// IsKnownEvent returns true when event is declared with On or handled with
+// Internal by a state. Like IsKnownState, it allows telling unknown events apart
+// from known events that can not be fired from the current state.
+func (s *StateMachine) IsKnownEvent(event string) bool {
+	for _, st := range s.definitions() {
+		if _, ok := st.internals[event]; ok || st.triggeredBy(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEachState calls fn with every state definition in definition order, until
+// fn returns false.
+func (s *StateMachine) ForEachState(fn func(*State) bool) {
+	for _, st := range s.definitions() {
+		if !fn(st) {
+			return
+		}
+	}
+}
+
+// ExplainTransition returns the reason a transition to name would be rejected
+// right now, or nil when it is permitted.
+func (s *StateMachine) ExplainTransition(name string) error {
+	_, err := s.IsValidStateChange(name)
+	return err
+}
+
+// Can returns true when a transition to name would currently be permitted. It
+// returns false until the machine has a current state.
+func (s *StateMachine) Can(name string) bool {
+	if !s.Exists() {
+		return false
+	}
+	_, err := s.IsValidStateChange(name)
+	return err == nil
+}
+
+// NextStates returns the destinations that can currently be transitioned to,
+// in definition order. Guards are evaluated, so it lists exactly the names
+// Can returns true for.
+func (s *StateMachine) NextStates() []string {
+	names := []string{}
+	for _, opt := range s.candidates(s.current()) {
+		if opt.Allowed {
+			names = append(names, opt.Name)
+		}
+	}
+	return names
+}
+
+// BlockedStates returns the destinations that can not currently be transitioned
+// to, in definition order, along with the reason for each.
+func (s *StateMachine) BlockedStates() []TransitionOption {
+	blocked := []TransitionOption{}
+	for _, opt := range s.candidates(s.current()) {
+		if !opt.Allowed {
+			blocked = append(blocked, opt)
+		}
+	}
+	return blocked
+}
+
+// AvailableTransitions returns every destination whose source rules permit a
+// change from the current state, along with whether the filter and guards
+// currently allow it. It evaluates all candidates in a single pass against the
+// state current when called, so the result is consistent even while the
+// machine moves on. The result is empty until the machine has a current state.
+func (s *StateMachine) AvailableTransitions() []TransitionOption {
+	opts := []TransitionOption{}
+	from := s.current()
+	for _, opt := range s.candidates(from) {
+		st, err := s.findPermitted(from, opt.Name)
+		if err == nil && s.permitsSource(from, st) {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// candidates evaluates every destination other than the given state.
+func (s *StateMachine) candidates(from *State) []TransitionOption {
+	opts := []TransitionOption{}
+	if from == nil {
+		return opts
+	}
+	seen := map[string]bool{}
+
+	for _, st := range s.definitions() {
+		if seen[st.Destination] || s.equal(from.Destination, st.Destination) {
+			continue
+		}
+		seen[st.Destination] = true
+
+		_, err := s.validStateChange(from, st.Destination)
+		opts = append(opts, TransitionOption{
+			Name:    st.Destination,
+			Allowed: err == nil,
+			Reason:  err,
+		})
+	}
+	return opts
+}
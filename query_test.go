@@ -0,0 +1,144 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueryMachine() *StateMachine {
+	sm := New()
+	sm.NewState().From("review").To("draft")
+	sm.NewState().From("draft").To("review")
+	sm.NewState().From("review").To("published").GuardWith(GuardFunc(func(from, to *State) bool {
+		return false
+	}))
+	sm.NewState().From("published").To("archived")
+	return sm
+}
+
+func TestCan(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+
+	assert.False(sm.Can("draft"), "should return false without a current state")
+
+	sm.CurrentState, _ = sm.Find("review")
+
+	assert.True(sm.Can("draft"), "should return true for permitted transitions")
+	assert.False(sm.Can("published"), "should return false when a guard rejects")
+	assert.False(sm.Can("missing"), "should return false for unknown states")
+	assert.Equal("review", sm.Name(), "should not change state")
+	assert.Equal(0, sm.QueueDepth(), "should not send transitions")
+}
+
+func TestNextStates(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+	sm.CurrentState, _ = sm.Find("review")
+
+	assert.Equal([]string{"draft"}, sm.NextStates(), "should list permitted destinations")
+}
+
+func TestBlockedStates(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+	sm.CurrentState, _ = sm.Find("review")
+
+	blocked := sm.BlockedStates()
+
+	assert.Len(blocked, 2, "should list rejected destinations except the current state")
+	assert.Equal("published", blocked[0].Name, "should keep definition order")
+	assert.EqualError(blocked[0].Reason, "Guard rejected transition: review > published", "should explain guard rejections")
+	assert.Equal("archived", blocked[1].Name, "should keep definition order")
+	assert.EqualError(blocked[1].Reason, "Invalid state change: review > archived", "should explain source rejections")
+}
+
+func TestExplainTransition(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+	sm.CurrentState, _ = sm.Find("review")
+
+	assert.Nil(sm.ExplainTransition("draft"), "should return nil when permitted")
+	assert.EqualError(sm.ExplainTransition("missing"), "Invalid state: missing", "should explain missing states")
+}
+
+func TestAvailableTransitions(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+	sm.CurrentState, _ = sm.Find("review")
+
+	opts := sm.AvailableTransitions()
+
+	assert.Len(opts, 2, "should list structurally valid destinations")
+	assert.Equal(TransitionOption{Name: "draft", Allowed: true}, opts[0], "should allow unguarded destinations")
+	assert.Equal("published", opts[1].Name, "should keep definition order")
+	assert.False(opts[1].Allowed, "should report guard rejections")
+	assert.EqualError(opts[1].Reason, "Guard rejected transition: review > published", "should explain guard rejections")
+}
+
+func TestAvailableTransitionsSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().To("foo")
+	qux := sm.NewState().FromAny().To("qux")
+	sm.NewState().From("foo").To("bar").Guard(func(from, to *State) bool {
+		// Move the machine on while the candidates are evaluated.
+		sm.setState(qux)
+		return true
+	})
+	sm.NewState().From("foo").To("baz")
+	sm.CurrentState, _ = sm.Find("foo")
+
+	names := []string{}
+	for _, opt := range sm.AvailableTransitions() {
+		names = append(names, opt.Name)
+	}
+	assert.Equal([]string{"qux", "bar", "baz"}, names, "should evaluate every candidate against the same state")
+}
+
+func TestAvailableTransitionsWithoutState(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+
+	assert.Equal([]TransitionOption{}, sm.AvailableTransitions(), "should return an empty slice without a current state")
+	assert.Equal([]string{}, sm.NextStates(), "should return an empty slice without a current state")
+}
+
+func TestIsKnownState(t *testing.T) {
+	assert := assert.New(t)
+	sm := newQueryMachine()
+
+	assert.True(sm.IsKnownState("archived"), "should know defined states")
+	assert.False(sm.IsKnownState("foobar"), "should not know undefined states")
+}
+
+func TestIsKnownEvent(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromAny().To("draft").Internal("save", func(*State) {})
+	sm.NewState().From("draft").To("review").On("submit")
+
+	assert.True(sm.IsKnownEvent("submit"), "should know events declared with On")
+	assert.True(sm.IsKnownEvent("save"), "should know events handled internally")
+	assert.False(sm.IsKnownEvent("foobar"), "should not know undeclared events")
+}
+
+func TestForEachState(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().Sequence("foo", "bar", "baz")
+
+	names := []string{}
+	sm.ForEachState(func(st *State) bool {
+		names = append(names, st.Destination)
+		return true
+	})
+	assert.Equal([]string{"foo", "bar", "baz"}, names, "should visit every state in definition order")
+
+	names = []string{}
+	sm.ForEachState(func(st *State) bool {
+		names = append(names, st.Destination)
+		return st.Destination != "bar"
+	})
+	assert.Equal([]string{"foo", "bar"}, names, "should stop once fn returns false")
+}
@@ -0,0 +1,84 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when a non blocking machine drops a transition.
+	ErrQueueFull = errors.New("Transition queue full")
+	// ErrEnqueueTimeout is returned when a transition can not be queued within
+	// the send timeout.
+	ErrEnqueueTimeout = errors.New("Transition enqueue timeout")
+)
+
+// NonBlocking makes Transition drop transitions that can not be queued right
+// away instead of waiting for the executor. Dropped transitions are not
+// committed, they are passed to the OnOverflow function and Transition returns
+// ErrQueueFull.
+func (s *StateMachine) NonBlocking() *StateMachine {
+	s.nonBlocking = true
+	return s
+}
+
+// OnOverflow sets a function to be called with every dropped transition.
+func (s *StateMachine) OnOverflow(f func(dropped *Transition)) {
+	s.overflowFn = f
+}
+
+// WithSendTimeout limits the time Transition waits for the executor to accept a
+// transition. Transitions which can not be queued in time are not committed
+// and return ErrEnqueueTimeout, so a stalled executor does not block callers
+// forever. It has no effect on non blocking machines.
+func (s *StateMachine) WithSendTimeout(d time.Duration) *StateMachine {
+	s.sendTimeout = d
+	return s
+}
+
+// QueueDepth returns the number of transitions waiting to be executed.
+func (s *StateMachine) QueueDepth() int {
+	return len(s.transitions)
+}
+
+// DroppedObservations returns the number of transitions dropped by a non
+// blocking machine.
+func (s *StateMachine) DroppedObservations() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// enqueue sends a transition to the executor, returning an error when it was
+// not queued.
+func (s *StateMachine) enqueue(t *Transition) error {
+	if s.nonBlocking {
+		select {
+		case s.transitions <- t:
+			return nil
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			if s.overflowFn != nil {
+				s.overflowFn(t)
+			}
+			return fmt.Errorf("%w: %v", ErrQueueFull, t.To.Destination)
+		}
+	}
+
+	if s.sendTimeout <= 0 {
+		s.transitions <- t
+		return nil
+	}
+
+	timer := time.NewTimer(s.sendTimeout)
+	defer timer.Stop()
+	select {
+	case s.transitions <- t:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: %v", ErrEnqueueTimeout, t.To.Destination)
+	}
+}
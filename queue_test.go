@@ -0,0 +1,63 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonBlocking(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().NonBlocking()
+	var dropped *Transition
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().FromAny().To("bar")
+	sm.OnOverflow(func(t *Transition) {
+		dropped = t
+	})
+
+	assert.Nil(sm.Transition("foo"), "should queue while there is room")
+	assert.Equal(1, sm.QueueDepth(), "should report the queued transition")
+
+	err := sm.Transition("bar")
+	assert.True(errors.Is(err, ErrQueueFull), "should reject when the queue is full")
+	assert.EqualError(err, "Transition queue full: bar", "should name the dropped state")
+	assert.Equal("bar", dropped.To.Destination, "should pass the dropped transition to OnOverflow")
+	assert.Equal(uint64(1), sm.DroppedObservations(), "should count dropped transitions")
+	assert.Equal("foo", sm.Name(), "should not commit dropped transitions")
+}
+
+func TestWithSendTimeout(t *testing.T) {
+	assert := assert.New(t)
+	sm := NewWithBuffer(Unbuffered).WithSendTimeout(10 * time.Millisecond)
+	sm.NewState().FromAny().To("foo")
+
+	err := sm.Transition("foo")
+	assert.True(errors.Is(err, ErrEnqueueTimeout), "should give up when nothing receives the transition")
+	assert.False(sm.Exists(), "should not commit the transition")
+}
+
+func TestExecutorPanic(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background()).WithSendTimeout(time.Second)
+	entered := make(chan bool, 1)
+
+	sm.NewState().FromAny().To("foo").Final()
+	sm.NewState().FromAny().To("bar").OnEnter(func(*State) {
+		entered <- true
+	})
+	sm.OnComplete(func(*State) {
+		panic("complete")
+	})
+	sm.Initialize()
+
+	sm.Transition("foo")
+	assert.EqualError(<-sm.Errors(), "Handler panicked: complete", "should recover panics of the executor")
+
+	assert.Nil(sm.Transition("bar"))
+	assert.True(<-entered, "should keep executing transitions")
+}
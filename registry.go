@@ -0,0 +1,61 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "fmt"
+
+// RegisterHandler makes f available to states referencing it by name, see
+// BindHandlers.
+func (s *StateMachine) RegisterHandler(name string, f func(*State)) {
+	if s.handlers == nil {
+		s.handlers = map[string]func(*State){}
+	}
+	s.handlers[name] = f
+}
+
+// OnEnterRef references a registered handler to be set as the enter function
+// by BindHandlers.
+func (st *State) OnEnterRef(name string) *State {
+	st.onEnterRef = name
+	return st
+}
+
+// OnExitRef references a registered handler to be set as the exit function by
+// BindHandlers.
+func (st *State) OnExitRef(name string) *State {
+	st.onExitRef = name
+	return st
+}
+
+// BindHandlers sets the enter and exit functions of every state referencing a
+// handler by name. It fails on the first reference to a handler which is not
+// registered, leaving the states bound so far.
+func (s *StateMachine) BindHandlers() error {
+	for _, st := range s.definitions() {
+		if st.onEnterRef != "" {
+			f, err := s.handler(st, st.onEnterRef)
+			if err != nil {
+				return err
+			}
+			st.OnEnter(f)
+		}
+		if st.onExitRef != "" {
+			f, err := s.handler(st, st.onExitRef)
+			if err != nil {
+				return err
+			}
+			st.OnExit(f)
+		}
+	}
+	return nil
+}
+
+// handler returns the registered handler referenced by st.
+func (s *StateMachine) handler(st *State, name string) (func(*State), error) {
+	f, ok := s.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v (referenced by %v)", ErrUnregisteredHandler, name, st.Destination)
+	}
+	return f, nil
+}
@@ -0,0 +1,53 @@
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindHandlers(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+
+	sm, err := LoadJSON([]byte(`[
+		{"destination": "draft", "onExit": "log"},
+		{"destination": "review", "sources": ["draft"], "onEnter": "notify"}
+	]`))
+	assert.Nil(err)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.RegisterHandler("log", func(st *State) {
+		calls = append(calls, "log "+st.Destination)
+	})
+	sm.RegisterHandler("notify", func(st *State) {
+		calls = append(calls, "notify "+st.Destination)
+	})
+	assert.Nil(sm.BindHandlers())
+
+	assert.Nil(sm.TransitionSync("draft"))
+	assert.Nil(sm.TransitionSync("review"))
+	assert.Equal([]string{"log draft", "notify review"}, calls, "should call the bound handlers")
+
+	out, err := json.Marshal(sm)
+	assert.Nil(err)
+	assert.Contains(string(out), `"onEnter":"notify"`, "should keep the references")
+}
+
+func TestBindHandlersUnregistered(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().To("draft").OnEnterRef("notify")
+
+	err := sm.BindHandlers()
+	assert.True(errors.Is(err, ErrUnregisteredHandler), "should reject unregistered handlers")
+	assert.EqualError(err, "Handler not registered: notify (referenced by draft)")
+}
@@ -0,0 +1,47 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "time"
+
+// Retry repeats a failed OnEnterE function up to attempts more times, waiting
+// backoff before each one. Retrying stops early when the state context is
+// done. Once the retries are exhausted, the last error fails the transition as
+// usual, and is sent to the Errors channel.
+func (st *State) Retry(attempts int, backoff time.Duration) *State {
+	st.retries = attempts
+	st.backoff = backoff
+	return st
+}
+
+// retried calls f with the state, retrying on error as configured by Retry.
+func (st *State) retried(f func(*State) error) error {
+	err := f(st)
+	for i := 0; err != nil && i < st.retries; i++ {
+		if !st.sleep(st.backoff) {
+			st.machine.log().Infof("Retrying cancelled: %v: %v", st.Destination, err)
+			return err
+		}
+		st.machine.log().Debugf("Retrying enter function: %v (attempt %d): %v", st.Destination, i+1, err)
+		err = f(st)
+	}
+	return err
+}
+
+// sleep waits for d, returning false when the state context is done first.
+func (st *State) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var done <-chan struct{}
+	if st.ctx != nil {
+		done = st.ctx.Done()
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
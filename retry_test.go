@@ -0,0 +1,93 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := 0
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Retry(2, time.Millisecond).OnEnterE(func(*State) error {
+		calls++
+		if calls < 3 {
+			return errors.New("Unavailable")
+		}
+		return nil
+	})
+
+	assert.Nil(sm.TransitionSync("foo"))
+	assert.Nil(sm.TransitionSync("bar"), "should succeed after retrying")
+	assert.Equal(3, calls, "should retry the failed enter function")
+	assert.True(sm.Match("bar"))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := 0
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo")
+	sm.NewState().From("foo").To("bar").Retry(2, time.Millisecond).OnEnterE(func(*State) error {
+		calls++
+		return errors.New("Unavailable")
+	})
+
+	assert.Nil(sm.TransitionSync("foo"))
+	assert.EqualError(sm.Transition("bar"), "Unavailable", "should report the last error")
+	assert.Equal(3, calls, "should stop after the configured attempts")
+	assert.True(sm.Match("foo"), "should roll back to the previous state")
+	assert.EqualError(<-sm.Errors(), "Unavailable", "should send the last error to the errors channel")
+}
+
+func TestRetryCancelled(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+	calls := int32(0)
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").Retry(10, time.Hour).OnEnterE(func(*State) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("Unavailable")
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- sm.Transition("foo")
+	}()
+
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, time.Second, 10*time.Millisecond)
+	sm.Stop()
+	assert.NotNil(<-done, "should fail once the machine is stopped")
+	assert.Equal(int32(1), atomic.LoadInt32(&calls), "should stop retrying once the state context is done")
+}
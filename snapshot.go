@@ -0,0 +1,38 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// StateInfo is a copy of the details of a state, which can be inspected without
+// affecting the machine.
+type StateInfo struct {
+	Name    string
+	Sources []string
+	// Start is set for the start state entered by Start.
+	Start    bool
+	Final    bool
+	Parallel bool
+	// ParallelIf is set when a ParallelIf function decides at transition time
+	// whether the state runs in parallel instead.
+	ParallelIf bool
+}
+
+// Snapshot returns a copy of the details of the current state, or the zero
+// StateInfo when there is none.
+func (s *StateMachine) Snapshot() StateInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current := s.CurrentState
+	if current == nil {
+		return StateInfo{}
+	}
+	return StateInfo{
+		Name:       current.Destination,
+		Sources:    append([]string{}, current.Source...),
+		Start:      current == s.start,
+		Final:      current.final,
+		Parallel:   current.parallel,
+		ParallelIf: current.parallelFn != nil,
+	}
+}
@@ -0,0 +1,49 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithContext(context.Background())
+
+	sm.OnStart(func(*State) {})
+	sm.NewState().FromStart().To("foo").Parallel(true)
+	sm.NewState().From("foo").To("bar").Final()
+
+	assert.Equal(StateInfo{}, sm.Snapshot(), "should be empty without a current state")
+
+	sm.Start()
+	assert.Equal(StateInfo{Sources: []string{}, Start: true}, sm.Snapshot(), "should report the start state")
+
+	sm.Transition("foo")
+	assert.Equal(StateInfo{Name: "foo", Sources: []string{}, Parallel: true}, sm.Snapshot())
+
+	sm.Transition("bar")
+	info := sm.Snapshot()
+	assert.Equal(StateInfo{Name: "bar", Sources: []string{"foo"}, Final: true}, info)
+
+	info.Sources[0] = "baz"
+	assert.Equal([]string{"foo"}, sm.CurrentState.Source, "should not share the sources")
+}
+
+func TestSnapshotParallelIf(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	calls := 0
+
+	sm.NewState().FromAny().To("foo").ParallelIf(func(*State) bool {
+		calls++
+		return false
+	})
+	sm.CurrentState, _ = sm.Find("foo")
+
+	info := sm.Snapshot()
+	assert.True(info.ParallelIf, "should report the ParallelIf function")
+	assert.False(info.Parallel, "should report the static flag")
+	assert.Equal(0, calls, "should not call the ParallelIf function")
+}
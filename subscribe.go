@@ -0,0 +1,84 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import "sync"
+
+// subscriberBuffer is the capacity of subscriber channels.
+const subscriberBuffer = 16
+
+// subscriber receives committed transitions on a channel.
+type subscriber struct {
+	mu     sync.Mutex
+	ch     chan *Transition
+	closed bool
+	remove func()
+}
+
+// send passes t to the subscriber, dropping it while the channel is full.
+func (sub *subscriber) send(t *Transition) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	select {
+	case sub.ch <- t:
+	default:
+	}
+}
+
+// close stops the subscriber and closes its channel.
+func (sub *subscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	sub.remove()
+	close(sub.ch)
+}
+
+// Subscribe returns a channel receiving every committed transition, and a
+// function cancelling the subscription. The channel is buffered and
+// transitions are dropped while it is full, so a slow subscriber does not stall
+// the machine. It is closed on unsubscribe or when the machine is stopped.
+func (s *StateMachine) Subscribe() (<-chan *Transition, func()) {
+	sub := &subscriber{ch: make(chan *Transition, subscriberBuffer)}
+	sub.remove = s.observeCommitted(sub.send)
+
+	s.observersMu.Lock()
+	if s.Stopped() {
+		s.observersMu.Unlock()
+		sub.close()
+		return sub.ch, func() {}
+	}
+	s.subscribers = append(s.subscribers, sub)
+	s.observersMu.Unlock()
+
+	return sub.ch, func() {
+		s.observersMu.Lock()
+		for i, existing := range s.subscribers {
+			if existing == sub {
+				s.subscribers = append(s.subscribers[:i:i], s.subscribers[i+1:]...)
+				break
+			}
+		}
+		s.observersMu.Unlock()
+		sub.close()
+	}
+}
+
+// closeSubscribers closes the channels of all subscribers.
+func (s *StateMachine) closeSubscribers() {
+	s.observersMu.Lock()
+	subscribers := s.subscribers
+	s.subscribers = nil
+	s.observersMu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.close()
+	}
+}
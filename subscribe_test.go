@@ -0,0 +1,64 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("bar").To("foo")
+	sm.NewState().From("foo").To("bar")
+	first, unsubscribe := sm.Subscribe()
+	second, _ := sm.Subscribe()
+
+	sm.Transition("foo")
+	assert.Equal("foo", (<-first).To.Destination, "should broadcast committed transitions")
+	assert.Equal("foo", (<-second).To.Destination, "should broadcast committed transitions")
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-first
+	assert.False(ok, "should close the channel on unsubscribe")
+
+	sm.Transition("bar")
+	assert.Equal("bar", (<-second).To.Destination, "should keep other subscribers")
+
+	sm.Stop()
+	_, ok = <-second
+	assert.False(ok, "should close the channel on stop")
+
+	late, _ := sm.Subscribe()
+	_, ok = <-late
+	assert.False(ok, "should close the channel when already stopped")
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").AllowSelf()
+	ch, _ := sm.Subscribe()
+
+	for i := 0; i < subscriberBuffer+4; i++ {
+		assert.Nil(sm.Transition("foo"), "should not be stalled by a full subscriber")
+	}
+	assert.Len(ch, subscriberBuffer, "should drop transitions while the channel is full")
+}
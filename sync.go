@@ -0,0 +1,45 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// waiter captures the transition dispatched for a blocking request. Lazy
+// waiters only wait for states entered by OnEnterE.
+type waiter struct {
+	tr   *Transition
+	lazy bool
+}
+
+// TransitionSync changes the state when permissible and blocks until the
+// inbound state has been entered, or the machine context is done. It must not
+// be called from a handler run by the executor, which would wait on itself.
+func (s *StateMachine) TransitionSync(to string) error {
+	return s.transition(transitionRequest{to: to, waiter: &waiter{}})
+}
+
+// WithBlockingTransitions makes every transition block like TransitionSync.
+func (s *StateMachine) WithBlockingTransitions() *StateMachine {
+	s.blocking = true
+	return s
+}
+
+// awaitExecuted blocks until the dispatched transition has been executed.
+func (s *StateMachine) awaitExecuted(w *waiter) error {
+	if w.tr == nil {
+		return nil
+	}
+
+	var cancelled <-chan struct{}
+	if s.ctx != nil {
+		cancelled = s.ctx.Done()
+	}
+
+	select {
+	case <-w.tr.done:
+		return w.tr.err
+	case <-cancelled:
+		from, to := w.tr.names()
+		s.log().Infof("Waiting for transition cancelled: %v > %v (#%d): %v", from, to, w.tr.ID, s.ctx.Err())
+		return s.ctx.Err()
+	}
+}
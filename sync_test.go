@@ -0,0 +1,64 @@
+package fsm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitionSync(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	entered := false
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			time.Sleep(5 * time.Millisecond)
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(*State) {
+		entered = true
+	})
+
+	assert.Nil(sm.TransitionSync("foo"), "should not return an error")
+	assert.True(entered, "should return once the state has been entered")
+	assert.Nil(sm.TransitionSync("foo"), "should not block on same state transitions")
+}
+
+func TestWithBlockingTransitions(t *testing.T) {
+	assert := assert.New(t)
+	sm := New().WithBlockingTransitions()
+	entered := false
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			time.Sleep(5 * time.Millisecond)
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").Parallel(true).OnEnter(func(*State) {
+		time.Sleep(5 * time.Millisecond)
+		entered = true
+	})
+
+	assert.Nil(sm.Transition("foo"), "should not return an error")
+	assert.True(entered, "should block parallel states too")
+}
+
+func TestTransitionSyncCancelled(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	sm := New().WithContext(ctx)
+
+	sm.NewState().FromAny().To("foo")
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	assert.EqualError(sm.TransitionSync("foo"), "context canceled", "should stop waiting when the machine is cancelled")
+}
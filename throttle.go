@@ -0,0 +1,102 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrThrottled is returned when a state is entered again within its throttle
+// interval.
+var ErrThrottled = errors.New("State throttled")
+
+// ThrottleMode decides what happens to transitions within the throttle interval.
+type ThrottleMode int
+
+const (
+	// ThrottleReject rejects the transition with ErrThrottled.
+	ThrottleReject ThrottleMode = iota
+	// ThrottleDelay holds the transition until the interval has passed.
+	ThrottleDelay
+)
+
+// ThrottleEntry limits entering the state to once per interval d. Transitions
+// within the interval are rejected, or delayed when mode is ThrottleDelay.
+func (st *State) ThrottleEntry(d time.Duration, mode ...ThrottleMode) *State {
+	st.throttle = d
+	st.throttleMode = ThrottleReject
+	st.initFlags()
+	if len(mode) > 0 {
+		st.throttleMode = mode[0]
+	}
+	return st
+}
+
+// throttled returns how long the state has to wait until it can be entered.
+func (st *State) throttled() time.Duration {
+	def := st.definition()
+	if def.throttle <= 0 {
+		return 0
+	}
+	last := atomic.LoadInt64(&st.flags.lastEntry)
+	if last == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(0, last).Add(def.throttle))
+}
+
+// throttleEntered records entering the state for throttling.
+func (st *State) throttleEntered() {
+	def := st.definition()
+	if def.throttle > 0 {
+		atomic.StoreInt64(&st.flags.lastEntry, time.Now().UnixNano())
+	}
+}
+
+// throttleDelay is returned by apply when a ThrottleDelay state has to be
+// waited for. The wait happens without holding the transition lock, so other
+// transitions are not held up.
+type throttleDelay struct {
+	st *State
+}
+
+func (d *throttleDelay) Error() string {
+	return fmt.Sprintf("%v: %v", ErrThrottled, d.st.Destination)
+}
+
+// checkThrottle returns ErrThrottled while st is within its throttle interval,
+// or a throttleDelay in ThrottleDelay mode.
+func (s *StateMachine) checkThrottle(st *State) error {
+	if st.throttled() <= 0 {
+		return nil
+	}
+	if st.definition().throttleMode != ThrottleDelay {
+		return fmt.Errorf("%w: %v", ErrThrottled, st.Destination)
+	}
+	return &throttleDelay{st: st}
+}
+
+// waitThrottle waits out the throttle interval of st, unless the machine stops.
+func (s *StateMachine) waitThrottle(st *State) error {
+	wait := st.throttled()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	if s.ctx == nil {
+		<-timer.C
+		return nil
+	}
+	select {
+	case <-timer.C:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleEntry(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("sync").To("idle")
+	sm.NewState().From("idle").To("sync").ThrottleEntry(time.Hour)
+
+	assert.Nil(sm.Transition("idle"), "should not return an error")
+	assert.Nil(sm.Transition("sync"), "should enter the state the first time")
+	assert.Nil(sm.Transition("idle"), "should not return an error")
+
+	err := sm.Transition("sync")
+	assert.True(errors.Is(err, ErrThrottled), "should reject entries within the interval")
+	assert.Equal("idle", sm.Name(), "should not change state")
+}
+
+func TestThrottleEntryDelay(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	d := 20 * time.Millisecond
+
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().From("sync").To("idle")
+	sm.NewState().From("idle").To("sync").ThrottleEntry(d, ThrottleDelay)
+
+	sm.Transition("idle")
+	sm.Transition("sync")
+	sm.Transition("idle")
+
+	begin := time.Now()
+	err := sm.Transition("sync")
+
+	assert.Nil(err, "should not return an error")
+	assert.Equal("sync", sm.Name(), "should enter the state once the interval has passed")
+	assert.True(time.Since(begin) >= d/2, "should delay the transition")
+}
+
+func TestThrottleEntryDelayUnlocked(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	d := 200 * time.Millisecond
+
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("idle")
+	sm.NewState().From("idle").To("sync").ThrottleEntry(d, ThrottleDelay)
+	sm.NewState().From("idle").To("other")
+
+	sm.Transition("idle")
+	sm.Transition("sync")
+	sm.Transition("idle")
+
+	delayed := make(chan error)
+	go func() {
+		delayed <- sm.Transition("sync")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	begin := time.Now()
+	assert.Nil(sm.Transition("other"), "should not wait for the delayed transition")
+	assert.True(time.Since(begin) < d/2, "should not be held up by the delayed transition")
+	assert.NotNil(<-delayed, "should apply the delayed transition to the new state")
+}
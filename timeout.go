@@ -0,0 +1,39 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// Timeout makes the machine transition to the state named to when the state is
+// not left within d of being entered. States with a timeout always get a
+// context, leaving the state cancels the timer.
+func (st *State) Timeout(d time.Duration, to string) *State {
+	st.timeout = d
+	st.timeoutState = to
+	return st
+}
+
+// startTimeout starts the timer of an entered state.
+func (s *StateMachine) startTimeout(st *State) {
+	if st.timeout <= 0 || st.ctx == nil {
+		return
+	}
+
+	go func(ctx context.Context) {
+		timer := time.NewTimer(st.timeout)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			if ctx.Err() == nil && s.current() == st {
+				s.log().Infof("State timed out: %v > %v", st.Destination, st.timeoutState)
+				s.emitError(s.Transition(st.timeoutState))
+			}
+		}
+	}(st.ctx)
+}
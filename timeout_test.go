@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("payment").Timeout(10*time.Millisecond, "expired")
+	sm.NewState().From("payment").To("expired")
+
+	sm.Transition("payment")
+
+	assert.Eventually(func() bool {
+		return sm.Name() == "expired"
+	}, time.Second, 10*time.Millisecond, "should transition once the timeout elapses")
+}
+
+func TestTimeoutCancelled(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	payment := sm.NewState().FromAny().To("payment").Timeout(10*time.Millisecond, "expired")
+	sm.NewState().From("payment").To("expired")
+	sm.NewState().From("payment").To("confirmed")
+
+	sm.Transition("payment")
+	sm.Transition("confirmed")
+
+	assert.NotNil(payment.Context().Err(), "should cancel the timer when the state is left")
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal("confirmed", sm.Name(), "should not transition after leaving the state")
+}
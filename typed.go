@@ -0,0 +1,85 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+// TypedMachine is a StateMachine whose transitions carry data of type T. The
+// untyped API remains available through the embedded machine.
+type TypedMachine[T any] struct {
+	*StateMachine
+}
+
+// TypedState is a State of a TypedMachine.
+type TypedState[T any] struct {
+	*State
+}
+
+// NewTyped returns a new, empty TypedMachine configured by opts.
+func NewTyped[T any](opts ...Option) *TypedMachine[T] {
+	return &TypedMachine[T]{New(opts...)}
+}
+
+// NewState returns a new state instance.
+func (m *TypedMachine[T]) NewState() *TypedState[T] {
+	return &TypedState[T]{m.StateMachine.NewState()}
+}
+
+// TransitionWith changes the state when permissible, passing data along to the
+// Data of the inbound state.
+func (m *TypedMachine[T]) TransitionWith(to string, data T) error {
+	return m.StateMachine.TransitionWith(to, data)
+}
+
+// From assigns a Source to the State.
+func (st *TypedState[T]) From(src ...string) *TypedState[T] {
+	st.State.From(src...)
+	return st
+}
+
+// To assigns a Destination to the State.
+func (st *TypedState[T]) To(dest string) *TypedState[T] {
+	st.State.To(dest)
+	return st
+}
+
+// FromAny allows the state to be transitioned to from any other state.
+func (st *TypedState[T]) FromAny() *TypedState[T] {
+	st.State.FromAny()
+	return st
+}
+
+// FromStart allows the state to be transitioned to from the start state.
+func (st *TypedState[T]) FromStart() *TypedState[T] {
+	st.State.FromStart()
+	return st
+}
+
+// Final marks the state as a final state of the workflow.
+func (st *TypedState[T]) Final() *TypedState[T] {
+	st.State.Final()
+	return st
+}
+
+// OnEnter setups the function to be called when the state is entered.
+func (st *TypedState[T]) OnEnter(f func(*TypedState[T])) *TypedState[T] {
+	st.State.OnEnter(func(s *State) {
+		f(&TypedState[T]{s})
+	})
+	return st
+}
+
+// OnExit setups the function to be called when the state is left.
+func (st *TypedState[T]) OnExit(f func(*TypedState[T])) *TypedState[T] {
+	st.State.OnExit(func(s *State) {
+		f(&TypedState[T]{s})
+	})
+	return st
+}
+
+// Data returns the data passed to TransitionWith by the transition that
+// entered the state. It is false when the state was entered without data of
+// type T, such as through the untyped API.
+func (st *TypedState[T]) Data() (T, bool) {
+	data, ok := st.State.TransitionData().(T)
+	return data, ok
+}
@@ -0,0 +1,43 @@
+package fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedMachine(t *testing.T) {
+	assert := assert.New(t)
+	sm := NewTyped[int]()
+	entered := []int{}
+	exited := []int{}
+
+	// Execute transitions.
+	go func() {
+		for transition := range sm.Transitions() {
+			transition.Do()
+		}
+	}()
+
+	sm.NewState().FromAny().To("foo").OnEnter(func(st *TypedState[int]) {
+		v, _ := st.Data()
+		entered = append(entered, v)
+	}).OnExit(func(st *TypedState[int]) {
+		v, _ := st.Data()
+		exited = append(exited, v)
+	})
+	sm.NewState().From("foo").To("bar").Final()
+
+	assert.Nil(sm.TransitionWith("foo", 7))
+	assert.Nil(sm.TransitionSync("bar"))
+	assert.Equal([]int{7}, entered, "should pass the data to the enter function")
+	assert.Equal([]int{7}, exited, "should pass the data to the exit function")
+	assert.True(sm.IsFinished(), "should keep the untyped API")
+
+	st, _ := sm.Find("foo")
+	_, ok := (&TypedState[int]{st}).Data()
+	assert.True(ok)
+	bar, _ := sm.Find("bar")
+	_, ok = (&TypedState[int]{bar}).Data()
+	assert.False(ok, "should report states entered without data")
+}
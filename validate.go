@@ -0,0 +1,108 @@
+// Edge Network
+// (c) 2019 Edge Network technologies Ltd.
+
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ErrDeadEnd is reported by Warnings for non-final states no other state can be
+// entered from.
+var ErrDeadEnd = errors.New("Dead end")
+
+// Validate checks the machine definition and returns every problem found, or an
+// empty slice when it is well formed. It reports states without a destination,
+// destinations defined more than once, sources and other references naming
+// undefined states, states none of whose sources are defined, and malformed
+// source patterns. States using FromAny or FromStart, and states without
+// sources, are entrypoints and always considered reachable, as are states
+// using FromPattern. Exclusive groups naming a state along with one of its
+// parents are reported as ErrExclusiveGroup, as the state can never be entered.
+func (s *StateMachine) Validate() []error {
+	errs := []error{}
+	counts := map[string]int{}
+
+	for _, st := range s.definitions() {
+		if st.Destination == "" {
+			errs = append(errs, fmt.Errorf("Empty destination: %v", st.Source))
+			continue
+		}
+		counts[st.Destination]++
+		if counts[st.Destination] == 2 {
+			errs = append(errs, fmt.Errorf("Duplicate state: %v", st.Destination))
+		}
+	}
+
+	for _, st := range s.definedStates() {
+		if st.Destination == "" {
+			continue
+		}
+
+		reachable := st.fromAny || st.fromStart || len(st.Source) == 0 || len(st.sourcePatterns) > 0
+		for _, src := range st.Source {
+			if s.IsKnownState(src) {
+				reachable = true
+				continue
+			}
+			errs = append(errs, fmt.Errorf("Unknown source: %v > %v", src, st.Destination))
+		}
+		for _, glob := range st.sourcePatterns {
+			if _, err := path.Match(glob, ""); err != nil {
+				errs = append(errs, fmt.Errorf("Malformed source pattern: %v > %v", glob, st.Destination))
+			}
+		}
+		if !reachable {
+			errs = append(errs, fmt.Errorf("%w: %v", ErrUnreachable, st.Destination))
+		}
+	}
+
+	for _, group := range s.groups {
+		for _, name := range group {
+			if !s.IsKnownState(name) {
+				errs = append(errs, fmt.Errorf("Unknown state in exclusive group: %v", name))
+			}
+		}
+		for _, st := range s.definedStates() {
+			if err := s.groupConflict(s.activeStates(st), group); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if s.invariantState != "" && !s.IsKnownState(s.invariantState) {
+		errs = append(errs, fmt.Errorf("Unknown invariant state: %v", s.invariantState))
+	}
+
+	return errs
+}
+
+// Warnings returns possible problems with the machine definition that do not
+// make it malformed. It reports non-final states no other state can be entered
+// from as ErrDeadEnd, unless they resolve their destination.
+func (s *StateMachine) Warnings() []error {
+	warnings := []error{}
+	for _, st := range s.definedStates() {
+		if st.Destination == "" || st.final || st.resolveFn != nil {
+			continue
+		}
+		if !s.hasOutgoing(st) {
+			warnings = append(warnings, fmt.Errorf("%w: %v", ErrDeadEnd, st.Destination))
+		}
+	}
+	return warnings
+}
+
+// hasOutgoing returns true when another state can be entered from st.
+func (s *StateMachine) hasOutgoing(st *State) bool {
+	for _, other := range s.definitions() {
+		if other.Destination == "" || s.equal(other.Destination, st.Destination) {
+			continue
+		}
+		if s.permitsSource(st, other) {
+			return true
+		}
+	}
+	return false
+}
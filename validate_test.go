@@ -0,0 +1,60 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().From("review").To("draft")
+	sm.NewState().From("draft").To("review")
+
+	assert.Equal([]error{}, sm.Validate(), "should return an empty slice for well formed machines")
+}
+
+func TestValidateErrors(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft", "reveiw").To("published")
+	sm.NewState().From("drfat").To("archived")
+	sm.NewState().From("draft").To("published")
+	sm.NewState().From("draft")
+	sm.ExclusiveGroup("draft", "pubished")
+
+	errs := sm.Validate()
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	assert.Equal([]string{
+		"Duplicate state: published",
+		"Empty destination: [draft]",
+		"Unknown source: reveiw > published",
+		"Unknown source: drfat > archived",
+		"State unreachable: archived",
+		"Unknown state in exclusive group: pubished",
+	}, msgs, "should report every problem in definition order")
+}
+
+func TestWarnings(t *testing.T) {
+	assert := assert.New(t)
+	sm := New()
+	sm.NewState().FromStart().To("draft")
+	sm.NewState().From("draft").To("review")
+	sm.NewState().From("draft").To("published").Final()
+
+	warnings := sm.Warnings()
+	assert.Equal([]error{}, sm.Validate(), "should not report dead ends as errors")
+	assert.Len(warnings, 1, "should report non-final states without outgoing transitions")
+	assert.True(errors.Is(warnings[0], ErrDeadEnd), "should return ErrDeadEnd")
+	assert.EqualError(warnings[0], "Dead end: review", "should name the state")
+
+	sm.NewState().FromAny().To("archived").Final()
+	assert.Equal([]error{}, sm.Warnings(), "should consider transitions from any state")
+}